@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector exposing the last published Snapshot.
+// Metrics are created at scrape time from the snapshot, therefore there is no
+// per-series registration in the registry.
+type Collector struct {
+	snapshot atomic.Pointer[Snapshot]
+	// publishMutex serializes writers, readers only load the pointer
+	publishMutex sync.Mutex
+}
+
+func New() *Collector {
+	c := &Collector{}
+	// Generation 0 is the empty snapshot served before the first poll
+	empty := NewSnapshot()
+	empty.sealed = true
+	c.snapshot.Store(empty)
+	return c
+}
+
+// Publish seals the snapshot, assigns it the next generation and atomically
+// replaces the snapshot served by the collector. Scrapes running concurrently
+// keep serving the previous generation until they complete.
+func (c *Collector) Publish(s *Snapshot) error {
+	c.publishMutex.Lock()
+	defer c.publishMutex.Unlock()
+
+	if s.sealed {
+		return ErrSealed
+	}
+	s.sealed = true
+	s.generation = c.snapshot.Load().generation + 1
+	c.snapshot.Store(s)
+	return nil
+}
+
+// Current returns the snapshot being served.
+func (c *Collector) Current() *Snapshot {
+	return c.snapshot.Load()
+}
+
+// Describe sends no descriptors: the exported series depend on the polled
+// data, so the collector is registered as unchecked.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.snapshot.Load()
+	for _, serie := range s.series {
+		// The series are validated by Snapshot.Add, an invalid one is
+		// reported by the registry instead of crashing the scrape
+		metric, err := prometheus.NewConstMetric(serie.desc, prometheus.GaugeValue, serie.value, serie.labelValues...)
+		if err != nil {
+			metric = prometheus.NewInvalidMetric(serie.desc, err)
+		}
+		ch <- metric
+	}
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollectorPublish(t *testing.T) {
+	c := New()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Fatalf("expected empty collector, got %d series", n)
+	}
+
+	snapshot := NewSnapshot()
+	rows := []struct {
+		labels prometheus.Labels
+		value  float64
+	}{
+		{prometheus.Labels{"ResourceId": "vm-1", "ServiceName": "compute"}, 1.5},
+		{prometheus.Labels{"ResourceId": "vm-2", "ServiceName": "compute"}, 2},
+		// Duplicated row, the last value wins
+		{prometheus.Labels{"ResourceId": "vm-1", "ServiceName": "compute"}, 3},
+	}
+	for _, row := range rows {
+		if err := snapshot.Add("billed_cost", "", row.labels, row.value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if err := c.Publish(snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot.Generation() != 1 {
+		t.Fatalf("expected generation 1, got %d", snapshot.Generation())
+	}
+
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",ServiceName="compute"} 3
+billed_cost{ResourceId="vm-2",ServiceName="compute"} 2
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "billed_cost"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.Publish(NewSnapshot()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Fatalf("expected series to be removed, got %d", n)
+	}
+}
+
+func TestSnapshotAddInvalidLabel(t *testing.T) {
+	snapshot := NewSnapshot()
+	if err := snapshot.Add("billed_cost", "", prometheus.Labels{"Resource Id": "vm-1"}, 1); err == nil {
+		t.Fatal("expected error for invalid label name")
+	}
+	if snapshot.Len() != 0 {
+		t.Fatalf("expected no series, got %d", snapshot.Len())
+	}
+}
+
+func TestSnapshotAddInvalidLabelValue(t *testing.T) {
+	c := New()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	snapshot := NewSnapshot()
+	if err := snapshot.Add("billed_cost", "", prometheus.Labels{"ServiceName": "Cafe"}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Same descriptor, e.g., a Latin-1 CSV, only the values differ
+	if err := snapshot.Add("billed_cost", "", prometheus.Labels{"ServiceName": "Caf\xe9"}, 2); err == nil {
+		t.Fatal("expected error for a label value not valid UTF-8")
+	}
+	if snapshot.Len() != 1 {
+		t.Fatalf("expected 1 series, got %d", snapshot.Len())
+	}
+	if err := c.Publish(snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := registry.Gather(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSnapshotSealed(t *testing.T) {
+	c := New()
+	snapshot := NewSnapshot()
+	if err := c.Publish(snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := snapshot.Add("billed_cost", "", prometheus.Labels{}, 1); !errors.Is(err, ErrSealed) {
+		t.Fatalf("expected ErrSealed adding to a published snapshot, got %v", err)
+	}
+	if err := c.Publish(snapshot); !errors.Is(err, ErrSealed) {
+		t.Fatalf("expected ErrSealed publishing twice, got %v", err)
+	}
+}
+
+func TestCollectorConsistentGenerations(t *testing.T) {
+	const seriesPerGeneration = 100
+
+	c := New()
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// A scrape sees either the empty generation or a complete one
+			if n := testutil.CollectAndCount(c); n != 0 && n != seriesPerGeneration {
+				t.Errorf("scrape observed a partial generation with %d series", n)
+				return
+			}
+		}
+	}()
+
+	for generation := 0; generation < 20; generation++ {
+		snapshot := NewSnapshot()
+		for i := 0; i < seriesPerGeneration; i++ {
+			labels := prometheus.Labels{"ResourceId": fmt.Sprintf("vm-%d-%d", generation, i)}
+			if err := snapshot.Add("billed_cost", "", labels, float64(i)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := c.Publish(snapshot); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if g := c.Current().Generation(); g != 20 {
+		t.Fatalf("expected generation 20, got %d", g)
+	}
+}
+
+func TestSnapshotDiff(t *testing.T) {
+	previous := NewSnapshot()
+	current := NewSnapshot()
+	for _, id := range []string{"vm-1", "vm-2"} {
+		if err := previous.Add("billed_cost", "", prometheus.Labels{"ResourceId": id}, 1); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, id := range []string{"vm-2", "vm-3", "vm-4"} {
+		if err := current.Add("billed_cost", "", prometheus.Labels{"ResourceId": id}, 2); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	added, removed := current.Diff(previous)
+	if added != 2 || removed != 1 {
+		t.Fatalf("expected 2 added and 1 removed, got %d added and %d removed", added, removed)
+	}
+}
+
+func TestWithUnits(t *testing.T) {
+	c := New()
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+
+	snapshot := NewSnapshot()
+	if err := snapshot.Add("disk_read_bytes", "", prometheus.Labels{"ResourceId": "vm-1"}, 1024); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := snapshot.Add("requests", "", prometheus.Labels{"ResourceId": "vm-1"}, 7); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := snapshot.SetUnit("disk_read_bytes", "bytes"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := c.Publish(snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	families, err := WithUnits(registry, c).Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	units := map[string]string{}
+	for _, family := range families {
+		units[family.GetName()] = family.GetUnit()
+	}
+	if units["disk_read_bytes"] != "bytes" || units["requests"] != "" {
+		t.Errorf("unexpected units: %v", units)
+	}
+}
+
+func TestHelps(t *testing.T) {
+	helps := NewHelps()
+	a, b := New(), New()
+
+	helps.Start(a)
+	if help := helps.Resolve(a, "cost", "Cost of a"); help != "Cost of a" {
+		t.Errorf("expected the help of a, got %q", help)
+	}
+	helps.Start(b)
+	if help := helps.Resolve(b, "cost", "Cost of b"); help != "Cost of a" {
+		t.Errorf("expected the help being built by a, got %q", help)
+	}
+	helps.Publish(a)
+	helps.Publish(b)
+
+	// A changed help text applies once the other collectors stop exporting
+	// the metric
+	helps.Start(b)
+	helps.Resolve(b, "usage", "Usage of b")
+	helps.Publish(b)
+	helps.Start(a)
+	if help := helps.Resolve(a, "cost", "Total cost"); help != "Total cost" {
+		t.Errorf("expected the changed help, got %q", help)
+	}
+	helps.Publish(a)
+
+	// The help texts of the metrics no longer exported are discarded
+	helps.Start(a)
+	helps.Publish(a)
+	if _, ok := helps.Get(b, "cost"); ok {
+		t.Error("expected the help of a metric no longer exported to be discarded")
+	}
+	if help, ok := helps.Get(a, "usage"); !ok || help != "Usage of b" {
+		t.Errorf("expected the help of b, got %q", help)
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import "sync"
+
+// Helps keeps a single help text per metric name across the collectors
+// registered on the same registry, which fails to gather metric families
+// with inconsistent help texts. A metric name takes the help text of the
+// first collector exporting it, among the published snapshots and the ones
+// being built. Only the help texts of the current snapshots are kept, so that
+// a changed help text applies once no other collector exports the metric.
+type Helps struct {
+	mutex sync.Mutex
+	// owners are the collectors in the order they first resolved a help text
+	owners []*Collector
+	helps  map[*Collector]*ownerHelps
+}
+
+// ownerHelps are the help texts of the published snapshot of a collector and
+// of the one being built
+type ownerHelps struct {
+	published map[string]string
+	pending   map[string]string
+}
+
+func NewHelps() *Helps {
+	return &Helps{helps: map[*Collector]*ownerHelps{}}
+}
+
+// Start discards the help texts resolved by owner for a snapshot that was
+// not published, it is called before building a new snapshot.
+func (h *Helps) Start(owner *Collector) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.owner(owner).pending = map[string]string{}
+}
+
+// Get returns the help text of the metric name, if it has been resolved by
+// owner for the snapshot being built or by another collector.
+func (h *Helps) Get(owner *Collector, name string) (string, bool) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.get(owner, name)
+}
+
+// Resolve returns the help text of the metric name for the snapshot of owner
+// being built, which is help unless another help text has already been
+// resolved for the same name.
+func (h *Helps) Resolve(owner *Collector, name string, help string) string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if resolved, ok := h.get(owner, name); ok {
+		help = resolved
+	}
+	h.owner(owner).pending[name] = help
+	return help
+}
+
+// Publish replaces the help texts of the published snapshot of owner with the
+// ones resolved while building it.
+func (h *Helps) Publish(owner *Collector) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	helps := h.owner(owner)
+	helps.published, helps.pending = helps.pending, map[string]string{}
+}
+
+func (h *Helps) get(owner *Collector, name string) (string, bool) {
+	if help, ok := h.owner(owner).pending[name]; ok {
+		return help, true
+	}
+	for _, other := range h.owners {
+		if other == owner {
+			continue
+		}
+		if help, ok := h.helps[other].published[name]; ok {
+			return help, true
+		}
+		if help, ok := h.helps[other].pending[name]; ok {
+			return help, true
+		}
+	}
+	return "", false
+}
+
+func (h *Helps) owner(owner *Collector) *ownerHelps {
+	helps, ok := h.helps[owner]
+	if !ok {
+		helps = &ownerHelps{published: map[string]string{}, pending: map[string]string{}}
+		h.helps[owner] = helps
+		h.owners = append(h.owners, owner)
+	}
+	return helps
+}
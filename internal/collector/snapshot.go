@@ -0,0 +1,187 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrSealed is returned when adding series to an already published Snapshot.
+var ErrSealed = errors.New("snapshot already published")
+
+// series is a single sample of the snapshot, its labels are stored as values
+// ordered like the variable labels of desc.
+type series struct {
+	desc *prometheus.Desc
+	// descKey identifies the metric name and label names, it is shared by all
+	// the series of the same desc
+	descKey     string
+	labelValues []string
+	value       float64
+}
+
+// Snapshot is a generation of series produced by a single poll. It is built
+// off to the side and sealed when published through a Collector, from then on
+// it is immutable and can be served concurrently without locking.
+type Snapshot struct {
+	generation uint64
+	createdAt  time.Time
+	sealed     bool
+
+	series []series
+	// index maps the hash of the identity of a series (name and label values)
+	// to its positions in series, so that duplicated rows overwrite the same
+	// sample without keeping a string key per series
+	index map[uint64][]int
+	descs map[string]snapshotDesc
+	// units maps the metric names to their OpenMetrics units
+	units map[string]string
+}
+
+type snapshotDesc struct {
+	desc *prometheus.Desc
+	key  string
+}
+
+func NewSnapshot() *Snapshot {
+	return &Snapshot{
+		createdAt: time.Now(),
+		index:     map[uint64][]int{},
+		descs:     map[string]snapshotDesc{},
+		units:     map[string]string{},
+	}
+}
+
+// SetUnit declares the OpenMetrics unit of the metric name, e.g., bytes. The
+// name of the metric should end with the unit.
+func (s *Snapshot) SetUnit(name string, unit string) error {
+	if s.sealed {
+		return ErrSealed
+	}
+	s.units[name] = unit
+	return nil
+}
+
+// Unit returns the OpenMetrics unit of the metric name.
+func (s *Snapshot) Unit(name string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	unit, ok := s.units[name]
+	return unit, ok
+}
+
+// Add stores a sample for the metric name with the given labels. If a sample
+// with the same name and labels is already present, its value is replaced.
+func (s *Snapshot) Add(name string, help string, labels prometheus.Labels, value float64) error {
+	if s.sealed {
+		return ErrSealed
+	}
+
+	labelNames := make([]string, 0, len(labels))
+	for k := range labels {
+		labelNames = append(labelNames, k)
+	}
+	sort.Strings(labelNames)
+
+	labelValues := make([]string, len(labelNames))
+	for i, k := range labelNames {
+		labelValues[i] = labels[k]
+		// The descriptor is validated once, the values of every series
+		if !utf8.ValidString(labelValues[i]) {
+			return fmt.Errorf("invalid metric %s: label value %q of %s is not valid UTF-8", name, labelValues[i], k)
+		}
+	}
+
+	descKey := name + "\xff" + strings.Join(labelNames, "\xff")
+	entry, ok := s.descs[descKey]
+	if !ok {
+		desc := prometheus.NewDesc(name, help, labelNames, nil)
+		// Validate the descriptor once, the label values are checked above
+		if _, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, 0, labelValues...); err != nil {
+			return fmt.Errorf("invalid metric %s: %w", name, err)
+		}
+		entry = snapshotDesc{desc: desc, key: descKey}
+		s.descs[descKey] = entry
+	}
+	// The series share the key stored with the desc instead of the one just built
+	descKey = entry.key
+	desc := entry.desc
+
+	hash := hashSeries(descKey, labelValues)
+	if i, ok := s.find(hash, descKey, labelValues); ok {
+		s.series[i].value = value
+		return nil
+	}
+	s.index[hash] = append(s.index[hash], len(s.series))
+	s.series = append(s.series, series{desc: desc, descKey: descKey, labelValues: labelValues, value: value})
+	return nil
+}
+
+// find returns the position of the series with the given identity
+func (s *Snapshot) find(hash uint64, descKey string, labelValues []string) (int, bool) {
+	for _, i := range s.index[hash] {
+		if s.series[i].descKey == descKey && slices.Equal(s.series[i].labelValues, labelValues) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func hashSeries(descKey string, labelValues []string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(descKey))
+	for _, value := range labelValues {
+		h.Write([]byte{0xfe})
+		h.Write([]byte(value))
+	}
+	return h.Sum64()
+}
+
+// Len returns the number of series in the snapshot.
+func (s *Snapshot) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.series)
+}
+
+// Generation returns the sequence number assigned when the snapshot was
+// published, 0 if it has not been published yet.
+func (s *Snapshot) Generation() uint64 {
+	if s == nil {
+		return 0
+	}
+	return s.generation
+}
+
+// CreatedAt returns when the snapshot started being built.
+func (s *Snapshot) CreatedAt() time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	return s.createdAt
+}
+
+// Diff returns how many series of the snapshot are not in previous and how
+// many series of previous are not in the snapshot.
+func (s *Snapshot) Diff(previous *Snapshot) (added int, removed int) {
+	for _, serie := range s.series {
+		if _, ok := previous.find(hashSeries(serie.descKey, serie.labelValues), serie.descKey, serie.labelValues); !ok {
+			added++
+		}
+	}
+	for _, serie := range previous.series {
+		if _, ok := s.find(hashSeries(serie.descKey, serie.labelValues), serie.descKey, serie.labelValues); !ok {
+			removed++
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// unitGatherer sets the units declared in the snapshots of the collectors on
+// the metric families, since the descriptors of client_golang have no unit.
+type unitGatherer struct {
+	prometheus.Gatherer
+	collectors []*Collector
+}
+
+// WithUnits returns a Gatherer adding the OpenMetrics units of the metrics of
+// the collectors to the metric families gathered by gatherer.
+func WithUnits(gatherer prometheus.Gatherer, collectors ...*Collector) prometheus.Gatherer {
+	return &unitGatherer{Gatherer: gatherer, collectors: collectors}
+}
+
+func (g *unitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.Gatherer.Gather()
+	snapshots := make([]*Snapshot, len(g.collectors))
+	for i, c := range g.collectors {
+		snapshots[i] = c.Current()
+	}
+	for _, family := range families {
+		for _, snapshot := range snapshots {
+			if unit, ok := snapshot.Unit(family.GetName()); ok {
+				family.Unit = &unit
+				break
+			}
+		}
+	}
+	return families, err
+}
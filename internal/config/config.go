@@ -0,0 +1,404 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/jsonpath"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/names"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/relabel"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = 1 * time.Second
+	DefaultMaxBackoff     = 1 * time.Minute
+	DefaultMaxPages       = 100
+	DefaultPageLimit      = 1000
+	DefaultMaxTagKeys     = 20
+	DefaultTagPrefix      = "tag_"
+)
+
+// Pagination strategies
+const (
+	PaginationNone       = ""
+	PaginationNextLink   = "nextLink"
+	PaginationToken      = "token"
+	PaginationLinkHeader = "linkHeader"
+	PaginationOffset     = "offset"
+)
+
+// Input formats, forcing the conversion of the response regardless of its
+// Content-Type
+const (
+	FormatAuto    = ""
+	FormatCSV     = "csv"
+	FormatTSV     = "tsv"
+	FormatJSON    = "json"
+	FormatNDJSON  = "ndjson"
+	FormatParquet = "parquet"
+)
+
+// Flattening of the arrays of generic JSON records
+const (
+	ArraysJSON    = "json"
+	ArraysIndex   = "index"
+	ArraysExplode = "explode"
+)
+
+const DefaultFlattenSeparator = "."
+
+// Compressions of the response, removed before the conversion
+const (
+	CompressionAuto  = ""
+	CompressionGzip  = "gzip"
+	CompressionZstd  = "zstd"
+	CompressionBzip2 = "bzip2"
+	CompressionZip   = "zip"
+	CompressionTar   = "tar"
+)
+
+// Config is the ExporterScraperConfig together with the options of the
+// exporter that are not part of the custom resource. The options are read
+// from the same file, as additional fields of spec.exporterConfig.
+type Config struct {
+	finopsdatatypes.ExporterScraperConfig
+
+	Options Options
+}
+
+// Options are the additional fields of spec.exporterConfig.
+type Options struct {
+	Retry      Retry      `yaml:"retry"`
+	Pagination Pagination `yaml:"pagination"`
+	// Format forces the format of the response, e.g., csv, instead of
+	// relying on the Content-Type
+	Format string `yaml:"format"`
+	// Compression forces the compression of the response, e.g., gzip
+	Compression string `yaml:"compression"`
+	// Generic are the additional fields of the generic block
+	Generic Generic `yaml:"generic"`
+	// Values are the columns exported as metrics, each with its own metric
+	// name, instead of the single value column of the metric type
+	Values []ValueColumn `yaml:"values"`
+	// Metric configures the names and the help of the metrics
+	Metric Metric `yaml:"metric"`
+	// Labels selects and renames the columns that become labels
+	Labels Labels `yaml:"labels"`
+	// Tags configures the labels of the tags of the Tags columns
+	Tags Tags `yaml:"tags"`
+	// Relabelings rewrite the labels of each record, as the relabel_configs
+	// of Prometheus
+	Relabelings []relabel.Config `yaml:"relabelings"`
+	// DecimalSeparator is the decimal separator of the values, "." or ",",
+	// empty to detect it from each value
+	DecimalSeparator string `yaml:"decimalSeparator"`
+}
+
+// Generic configures how the records of generic JSON responses are read.
+type Generic struct {
+	// ValueColumn is the name of the column with the value of the metric,
+	// it takes precedence over the valueColumnIndex of the generic block
+	ValueColumn string `yaml:"valueColumn"`
+	// RecordsPath is the JSONPath expression selecting the records, e.g.,
+	// $.data.items, instead of the first array of objects in the response
+	RecordsPath string `yaml:"recordsPath"`
+	// Columns are added to each record, with the values selected by their
+	// JSONPath expressions relative to the record
+	Columns []Column `yaml:"columns"`
+	// Flatten configures how nested objects and arrays become columns
+	Flatten Flatten `yaml:"flatten"`
+}
+
+// Flatten configures how the nested objects and arrays of generic JSON
+// records become columns. The keys of nested objects are always joined, e.g.,
+// tags.team.
+type Flatten struct {
+	// Separator joins the keys of nested objects and the array indexes
+	Separator string `yaml:"separator"`
+	// Arrays is one of json (an array is a column with its JSON encoding),
+	// index (a column per element, e.g., zones.0) and explode (a row per
+	// element)
+	Arrays string `yaml:"arrays"`
+}
+
+// ValueColumn is a column exported as a metric, the other columns of the
+// record are the labels of the metric.
+type ValueColumn struct {
+	Column string `yaml:"column"`
+	// MetricName is the name of the metric, by default the column in snake
+	// case, e.g., effective_cost for EffectiveCost
+	MetricName string `yaml:"metricName"`
+}
+
+// Metric configures the names and the help of the metrics with templates,
+// which can reference the columns of the record, e.g., {{ .metricName }}, the
+// configuration, e.g., {{ .Config.Name }}, and the value column, e.g.,
+// {{ .Value.MetricName }}.
+type Metric struct {
+	// Name is the template of the metric names, the metric name of the
+	// metric type by default
+	Name string `yaml:"name"`
+	// Help is the template of the help texts
+	Help string `yaml:"help"`
+	// Unit is appended to the metric names, e.g., usd
+	Unit string `yaml:"unit"`
+	// NormalizeUnits converts the values of the resource metric type into
+	// the base unit of their unit column, e.g., Percent into ratio, which is
+	// appended to the metric names
+	NormalizeUnits bool `yaml:"normalizeUnits"`
+}
+
+// Labels selects the columns that become labels. A column is a label when it
+// is included, by name or by regular expression, or when nothing is included,
+// and it is not excluded. The names are matched case insensitively and the
+// regular expressions are anchored, like the ones of Prometheus.
+type Labels struct {
+	Include      []string `yaml:"include"`
+	IncludeRegex string   `yaml:"includeRegex"`
+	Exclude      []string `yaml:"exclude"`
+	ExcludeRegex string   `yaml:"excludeRegex"`
+	// Rename maps the columns to the names of their labels
+	Rename map[string]string `yaml:"rename"`
+	// KeepValueColumns keeps the value columns as labels too
+	KeepValueColumns bool `yaml:"keepValueColumns"`
+}
+
+// Tags configures how the Tags columns, e.g., {"team":"x","env":"prod"},
+// become labels. By default each Tags column is a single label, e.g.,
+// team:x;env:prod.
+type Tags struct {
+	// Explode makes a label of each tag, e.g., tag_team, instead of the
+	// label of the Tags column
+	Explode bool `yaml:"explode"`
+	// Keys are the tags that become labels, matched case insensitively,
+	// empty for all the tags
+	Keys []string `yaml:"keys"`
+	// MaxKeys caps the number of distinct tags that become labels in a poll,
+	// the tags found after the first MaxKeys are ignored
+	MaxKeys int `yaml:"maxKeys"`
+	// Prefix is added to the labels of the tags, tag_ by default
+	Prefix string `yaml:"prefix"`
+	// KeepColumn keeps the label of the Tags column too
+	KeepColumn bool `yaml:"keepColumn"`
+}
+
+// Column is a column computed from each record of generic JSON responses.
+type Column struct {
+	Name string `yaml:"name"`
+	Path string `yaml:"path"`
+}
+
+// Retry configures how failed API requests are retried within a poll.
+type Retry struct {
+	// MaxAttempts is the number of requests performed before the poll fails
+	MaxAttempts int `yaml:"maxAttempts"`
+	// InitialBackoff is the wait before the first retry, doubled at every attempt
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	// MaxBackoff caps the wait between attempts and before polling again after a failure
+	MaxBackoff time.Duration `yaml:"maxBackoff"`
+}
+
+// Pagination configures how the pages of a paginated API are requested. All
+// the pages are fetched in the same poll and their records are merged.
+type Pagination struct {
+	// Type is one of nextLink, token, linkHeader and offset, empty to disable pagination
+	Type string `yaml:"type"`
+	// NextLinkPath is the dot separated path of the next page URL in the
+	// JSON response, e.g., nextLink (Azure) or properties.nextLink
+	NextLinkPath string `yaml:"nextLinkPath"`
+	// TokenPath is the dot separated path of the continuation token in the
+	// JSON response, e.g., NextToken (AWS) or nextPageToken (GCP)
+	TokenPath string `yaml:"tokenPath"`
+	// TokenParam is the query parameter carrying the token in the next request
+	TokenParam string `yaml:"tokenParam"`
+	// OffsetParam and LimitParam are the query parameters of offset pagination
+	OffsetParam string `yaml:"offsetParam"`
+	LimitParam  string `yaml:"limitParam"`
+	// Limit is the number of records requested per page with offset pagination
+	Limit int `yaml:"limit"`
+	// MaxPages caps the number of pages requested in a single poll
+	MaxPages int `yaml:"maxPages"`
+}
+
+// ParseOptions reads the exporter options from the configuration file
+// content, applying the defaults for the missing fields.
+func ParseOptions(data []byte) (Options, error) {
+	parse := struct {
+		Spec struct {
+			ExporterConfig Options `yaml:"exporterConfig"`
+		} `yaml:"spec"`
+	}{}
+	if err := yaml.Unmarshal(data, &parse); err != nil {
+		return Options{}, err
+	}
+
+	options := parse.Spec.ExporterConfig
+	if options.Retry.MaxAttempts <= 0 {
+		options.Retry.MaxAttempts = DefaultMaxAttempts
+	}
+	if options.Retry.InitialBackoff <= 0 {
+		options.Retry.InitialBackoff = DefaultInitialBackoff
+	}
+	if options.Retry.MaxBackoff <= 0 {
+		options.Retry.MaxBackoff = DefaultMaxBackoff
+	}
+
+	pagination := &options.Pagination
+	switch pagination.Type {
+	case PaginationNone, PaginationLinkHeader:
+	case PaginationNextLink:
+		if pagination.NextLinkPath == "" {
+			pagination.NextLinkPath = "nextLink"
+		}
+	case PaginationToken:
+		if pagination.TokenPath == "" || pagination.TokenParam == "" {
+			return Options{}, fmt.Errorf("token pagination requires tokenPath and tokenParam")
+		}
+	case PaginationOffset:
+		if pagination.OffsetParam == "" {
+			pagination.OffsetParam = "offset"
+		}
+		if pagination.LimitParam == "" {
+			pagination.LimitParam = "limit"
+		}
+		if pagination.Limit <= 0 {
+			pagination.Limit = DefaultPageLimit
+		}
+	default:
+		return Options{}, fmt.Errorf("unknown pagination type: %s", pagination.Type)
+	}
+	if pagination.MaxPages <= 0 {
+		pagination.MaxPages = DefaultMaxPages
+	}
+
+	options.Format = strings.ToLower(options.Format)
+	switch options.Format {
+	case FormatAuto, FormatCSV, FormatTSV, FormatJSON, FormatNDJSON, FormatParquet:
+	default:
+		return Options{}, fmt.Errorf("unsupported format: %s", options.Format)
+	}
+	options.Compression = strings.ToLower(options.Compression)
+	switch options.Compression {
+	case CompressionAuto, CompressionGzip, CompressionZstd, CompressionBzip2, CompressionZip, CompressionTar:
+	default:
+		return Options{}, fmt.Errorf("unsupported compression: %s", options.Compression)
+	}
+
+	switch options.DecimalSeparator {
+	case "", ".", ",":
+	default:
+		return Options{}, fmt.Errorf("unsupported decimal separator: %q", options.DecimalSeparator)
+	}
+
+	metricNames := map[string]string{}
+	for i := range options.Values {
+		value := &options.Values[i]
+		if value.Column == "" {
+			return Options{}, fmt.Errorf("value %d has no column", i)
+		}
+		if value.MetricName == "" {
+			value.MetricName = names.Snake(value.Column)
+		}
+		if !model.IsValidMetricName(model.LabelValue(value.MetricName)) {
+			return Options{}, fmt.Errorf("invalid metric name of value column %s: %s", value.Column, value.MetricName)
+		}
+		// Otherwise the series of the value columns would overwrite each other
+		if other, ok := metricNames[value.MetricName]; ok {
+			return Options{}, fmt.Errorf("value columns %s and %s have the same metric name: %s", other, value.Column, value.MetricName)
+		}
+		metricNames[value.MetricName] = value.Column
+	}
+
+	if options.Metric.Name != "" {
+		if _, err := names.ParseTemplate("name", options.Metric.Name); err != nil {
+			return Options{}, fmt.Errorf("invalid metric name template: %w", err)
+		}
+		if !strings.Contains(options.Metric.Name, "{{") && !model.IsValidMetricName(model.LabelValue(options.Metric.Name)) {
+			return Options{}, fmt.Errorf("invalid metric name: %s", options.Metric.Name)
+		}
+		// Otherwise the series of the value columns would overwrite each other
+		if len(options.Values) > 1 && !strings.Contains(options.Metric.Name, ".Value") {
+			return Options{}, fmt.Errorf("the metric name template must reference .Value, e.g., {{ .Value.MetricName }}, with multiple values")
+		}
+	}
+	if _, err := names.ParseTemplate("help", options.Metric.Help); err != nil {
+		return Options{}, fmt.Errorf("invalid metric help template: %w", err)
+	}
+	if options.Metric.Unit != "" && names.Sanitize(options.Metric.Unit) != options.Metric.Unit {
+		return Options{}, fmt.Errorf("invalid metric unit: %s", options.Metric.Unit)
+	}
+
+	for _, expression := range []string{options.Labels.IncludeRegex, options.Labels.ExcludeRegex} {
+		if _, err := CompileRegex(expression); err != nil {
+			return Options{}, fmt.Errorf("invalid labels regex: %w", err)
+		}
+	}
+	for column, label := range options.Labels.Rename {
+		if !model.LabelName(label).IsValid() || strings.HasPrefix(label, "__") {
+			return Options{}, fmt.Errorf("invalid label name for column %s: %s", column, label)
+		}
+	}
+
+	if options.Tags.MaxKeys <= 0 {
+		options.Tags.MaxKeys = DefaultMaxTagKeys
+	}
+	if options.Tags.Prefix == "" {
+		options.Tags.Prefix = DefaultTagPrefix
+	}
+	if !model.LabelName(options.Tags.Prefix+"a").IsValid() || strings.HasPrefix(options.Tags.Prefix, "__") {
+		return Options{}, fmt.Errorf("invalid tags prefix: %s", options.Tags.Prefix)
+	}
+
+	for i, relabeling := range options.Relabelings {
+		if _, err := relabel.Compile(relabeling); err != nil {
+			return Options{}, fmt.Errorf("invalid relabeling %d: %w", i, err)
+		}
+	}
+
+	if options.Generic.RecordsPath != "" {
+		if _, err := jsonpath.Compile(options.Generic.RecordsPath); err != nil {
+			return Options{}, fmt.Errorf("invalid recordsPath: %w", err)
+		}
+	}
+	flatten := &options.Generic.Flatten
+	if flatten.Separator == "" {
+		flatten.Separator = DefaultFlattenSeparator
+	}
+	switch flatten.Arrays {
+	case "":
+		flatten.Arrays = ArraysJSON
+	case ArraysJSON, ArraysIndex, ArraysExplode:
+	default:
+		return Options{}, fmt.Errorf("unknown flattening of arrays: %s", flatten.Arrays)
+	}
+	// The offset advances by the rows of the page, which are more than the
+	// records of the API when the arrays are exploded
+	if flatten.Arrays == ArraysExplode && options.Pagination.Type == PaginationOffset {
+		return Options{}, fmt.Errorf("offset pagination does not support exploded arrays")
+	}
+	for i, column := range options.Generic.Columns {
+		if column.Name == "" {
+			return Options{}, fmt.Errorf("column %d has no name", i)
+		}
+		if _, err := jsonpath.Compile(column.Path); err != nil {
+			return Options{}, fmt.Errorf("invalid path of column %s: %w", column.Name, err)
+		}
+	}
+	return options, nil
+}
+
+// CompileRegex compiles the regular expression anchored at both ends, an
+// empty expression matches nothing and is returned as nil
+func CompileRegex(expression string) (*regexp.Regexp, error) {
+	if expression == "" {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expression + ")$")
+}
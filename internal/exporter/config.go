@@ -0,0 +1,148 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/utils"
+)
+
+// configMetadata is used to read the metadata of the configuration, since
+// ObjectMeta does not declare yaml tags
+type configMetadata struct {
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// ParseConfigFile reads the configuration file, the endpoint it references is
+// resolved separately through an endpoints Provider.
+func ParseConfigFile(file string) (exporterconfig.Config, error) {
+	fileReader, err := os.OpenFile(file, os.O_RDONLY, 0600)
+	if err != nil {
+		return exporterconfig.Config{}, err
+	}
+	defer fileReader.Close()
+	data, err := io.ReadAll(fileReader)
+	if err != nil {
+		return exporterconfig.Config{}, err
+	}
+
+	parse := finopsdatatypes.ExporterScraperConfig{}
+
+	err = yaml.Unmarshal(data, &parse)
+	if err != nil {
+		return exporterconfig.Config{}, err
+	}
+
+	metadata := configMetadata{}
+	err = yaml.Unmarshal(data, &metadata)
+	if err != nil {
+		return exporterconfig.Config{}, err
+	}
+	options, err := exporterconfig.ParseOptions(data)
+	if err != nil {
+		return exporterconfig.Config{}, err
+	}
+
+	parse.Name = metadata.Metadata.Name
+	parse.Namespace = metadata.Metadata.Namespace
+	if parse.Name == "" {
+		parse.Name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	// Replace variables in API path
+	parse.Spec.ExporterConfig.API.Path = utils.ReplaceVariables(parse.Spec.ExporterConfig.API.Path, parse.Spec.ExporterConfig.AdditionalVariables)
+
+	return exporterconfig.Config{ExporterScraperConfig: parse, Options: options}, nil
+
+}
+
+// ConfigFiles expands the given paths into the list of configuration files to
+// load. Directories are scanned (non-recursively) for .yaml and .yml files,
+// hidden entries such as the ..data folder of mounted ConfigMaps are skipped.
+func ConfigFiles(paths []string) ([]string, error) {
+	files := []string{}
+	seen := map[string]struct{}{}
+	add := func(file string) {
+		if _, ok := seen[file]; !ok {
+			seen[file] = struct{}{}
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read configuration path %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not list configuration directory %s: %w", path, err)
+		}
+		dirFiles := []string{}
+		for _, entry := range entries {
+			name := entry.Name()
+			if strings.HasPrefix(name, ".") {
+				continue
+			}
+			ext := strings.ToLower(filepath.Ext(name))
+			if ext != ".yaml" && ext != ".yml" {
+				continue
+			}
+			// Entries of mounted ConfigMaps are symlinks, follow them
+			entryInfo, err := os.Stat(filepath.Join(path, name))
+			if err != nil || entryInfo.IsDir() {
+				continue
+			}
+			dirFiles = append(dirFiles, filepath.Join(path, name))
+		}
+		sort.Strings(dirFiles)
+		for _, file := range dirFiles {
+			add(file)
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files found in %s", strings.Join(paths, ","))
+	}
+	return files, nil
+}
+
+// CheckConfigNames returns an error if two configuration files have the same
+// name and namespace, e.g., two config.yaml files without metadata in
+// different directories, since their series would be identical and fail the
+// scrapes. The files that cannot be parsed yet are ignored.
+func CheckConfigNames(files []string) error {
+	seen := map[string]string{}
+	for _, file := range files {
+		config, err := ParseConfigFile(file)
+		if err != nil {
+			continue
+		}
+		key := config.Namespace + "/" + config.Name
+		if other, ok := seen[key]; ok {
+			return fmt.Errorf("configurations %s and %s are both named %s", other, file, key)
+		}
+		seen[key] = file
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package exporter
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	// Layout of a mounted ConfigMap: the keys are symlinks into ..data
+	dataDir := filepath.Join(dir, "..data")
+	if err := os.Mkdir(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"b.yaml", "a.yml", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dataDir, name), []byte("spec: {}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join("..data", name), filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	single := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(single, []byte("spec: {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ConfigFiles([]string{dir, " " + single, single, ""})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []string{filepath.Join(dir, "a.yml"), filepath.Join(dir, "b.yaml"), single}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatalf("got %v, expected %v", files, expected)
+	}
+
+	if _, err := ConfigFiles([]string{t.TempDir()}); err == nil {
+		t.Fatal("expected error for directory without configuration files")
+	}
+	if _, err := ConfigFiles([]string{filepath.Join(dir, "missing.yaml")}); err == nil {
+		t.Fatal("expected error for missing file")
+	}
+}
+
+func TestCheckConfigNames(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	files := []string{filepath.Join(dirs[0], "config.yaml"), filepath.Join(dirs[1], "config.yaml")}
+	for _, file := range files {
+		if err := os.WriteFile(file, []byte("spec: {}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CheckConfigNames(files); err == nil {
+		t.Fatal("expected error for configurations with the same name")
+	}
+
+	if err := os.WriteFile(files[1], []byte("metadata:\n  name: config\n  namespace: finops\nspec: {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckConfigNames(files); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	options, err := exporterconfig.ParseOptions([]byte(`
+spec:
+  exporterConfig:
+    format: CSV
+    compression: gzip
+    decimalSeparator: ","
+    values:
+      - column: EffectiveCost
+      - column: ListCost
+        metricName: list_cost_usd
+    generic:
+      valueColumnIndex: 0
+      valueColumn: cost
+      metricName: cost
+      recordsPath: $.data.items
+      columns:
+        - name: location
+          path: properties.location
+      flatten:
+        arrays: explode
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if options.Format != exporterconfig.FormatCSV || options.Compression != exporterconfig.CompressionGzip {
+		t.Errorf("unexpected format options: %+v", options)
+	}
+	if options.DecimalSeparator != "," {
+		t.Errorf("expected decimal separator \",\", got %q", options.DecimalSeparator)
+	}
+	if options.Tags.MaxKeys != exporterconfig.DefaultMaxTagKeys || options.Tags.Prefix != exporterconfig.DefaultTagPrefix {
+		t.Errorf("unexpected tags defaults: %+v", options.Tags)
+	}
+	expectedValues := []exporterconfig.ValueColumn{
+		{Column: "EffectiveCost", MetricName: "effective_cost"},
+		{Column: "ListCost", MetricName: "list_cost_usd"},
+	}
+	if !reflect.DeepEqual(options.Values, expectedValues) {
+		t.Errorf("expected %+v, got %+v", expectedValues, options.Values)
+	}
+	expected := exporterconfig.Generic{
+		ValueColumn: "cost",
+		RecordsPath: "$.data.items",
+		Columns:     []exporterconfig.Column{{Name: "location", Path: "properties.location"}},
+		Flatten:     exporterconfig.Flatten{Separator: ".", Arrays: exporterconfig.ArraysExplode},
+	}
+	if !reflect.DeepEqual(options.Generic, expected) {
+		t.Errorf("expected %+v, got %+v", expected, options.Generic)
+	}
+
+	for _, data := range []string{
+		"format: xml",
+		"compression: rar",
+		"generic: {recordsPath: '$.data['}",
+		"generic: {columns: [{path: a.b}]}",
+		"generic: {columns: [{name: a, path: ''}]}",
+		"generic: {flatten: {arrays: zip}}",
+		"{pagination: {type: offset}, generic: {flatten: {arrays: explode}}}",
+		"decimalSeparator: ';'",
+		"values: [{metricName: cost}]",
+		"labels: {includeRegex: 'Resource('}",
+		"labels: {rename: {ResourceId: resource-id}}",
+		"relabelings: [{action: uppercase, targetLabel: a}]",
+		"tags: {prefix: '0'}",
+		"metric: {name: '{{ .unit '}",
+		"metric: {name: 'billed-cost'}",
+		"{values: [{column: BilledCost}, {column: EffectiveCost}], metric: {name: cost}}",
+		"{values: [{column: BilledCost}, {column: EffectiveCost}], metric: {name: '{{ .unit }}_cost'}}",
+		"metric: {help: '{{ .unit | unknown }}'}",
+		"metric: {unit: 'US Dollars'}",
+		"values: [{column: cost, metricName: 'list-cost'}]",
+		"values: [{column: BilledCost, metricName: cost}, {column: EffectiveCost, metricName: cost}]",
+		"values: [{column: BilledCost}, {column: billed_cost}]",
+	} {
+		if _, err := exporterconfig.ParseOptions([]byte("spec:\n  exporterConfig:\n    " + data + "\n")); err == nil {
+			t.Errorf("expected an error for %s", data)
+		}
+	}
+
+	data := "{values: [{column: BilledCost}, {column: EffectiveCost}], metric: {name: 'azure_{{ .Value.MetricName }}'}}"
+	if _, err := exporterconfig.ParseOptions([]byte("spec:\n  exporterConfig:\n    " + data + "\n")); err != nil {
+		t.Errorf("unexpected error for %s: %v", data, err)
+	}
+}
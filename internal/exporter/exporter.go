@@ -0,0 +1,220 @@
+package exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"k8s.io/client-go/rest"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/collector"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	localendpoints "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/endpoints"
+)
+
+// Exporter polls the API described by a single configuration file and
+// publishes the resulting series through its own collector.
+type Exporter struct {
+	file      string
+	collector *collector.Collector
+	metrics   *Metrics
+	// helps are the help texts of the metrics, shared by the exporters
+	// registered on the same registry
+	helps *collector.Helps
+
+	// reload is signalled by the configuration watcher
+	reload chan struct{}
+
+	mutex           sync.Mutex
+	cancelIteration context.CancelFunc
+	status          Status
+}
+
+func New(file string, metrics *Metrics, helps *collector.Helps) *Exporter {
+	return &Exporter{
+		file:      file,
+		collector: collector.New(),
+		metrics:   metrics,
+		helps:     helps,
+		reload:    make(chan struct{}, 1),
+	}
+}
+
+// Collector returns the collector serving the series of this exporter.
+func (e *Exporter) Collector() *collector.Collector {
+	return e.collector
+}
+
+// Run polls the API until the context is cancelled. The configuration is
+// parsed on start and again only when the file changes, a change interrupts
+// the current iteration so that it is applied immediately. On failure the
+// previous generation stays published until a poll succeeds.
+func (e *Exporter) Run(ctx context.Context) {
+	logger := log.With().Str("config", e.file).Logger()
+	go e.watchConfig(ctx, logger)
+
+	var config exporterconfig.Config
+	var provider *localendpoints.Provider
+	// stopProvider stops watching the Secret of the previous configuration
+	stopProvider := func() {}
+	defer func() { stopProvider() }()
+	loaded := false
+	for {
+		select {
+		case <-e.reload:
+			loaded = false
+		default:
+		}
+
+		iterationCtx, cancel := context.WithCancel(ctx)
+		e.mutex.Lock()
+		e.cancelIteration = cancel
+		e.mutex.Unlock()
+
+		if !loaded {
+			var err error
+			config, err = ParseConfigFile(e.file)
+			if err == nil {
+				stopProvider()
+				provider, stopProvider = startProvider(ctx, config)
+				// Resolve the endpoint now to report configuration errors early
+				_, err = provider.Get(iterationCtx)
+			}
+			if err != nil {
+				logger.Error().Err(err).Msg("error while parsing configuration, trying again in 5s...")
+				e.updateStatus(func(status *Status) {
+					status.LastError = err.Error()
+				})
+				sleep(iterationCtx, 5*time.Second)
+			} else {
+				loaded = true
+				e.updateStatus(func(status *Status) {
+					status.Name = config.Name
+					status.Namespace = config.Namespace
+					status.PollingInterval = config.Spec.ExporterConfig.PollingInterval.Duration.String()
+					status.pollingInterval = config.Spec.ExporterConfig.PollingInterval.Duration
+					status.failureWait = failureWait(config)
+				})
+				logger.Info().Msgf("Loaded configuration %s/%s", config.Namespace, config.Name)
+			}
+		}
+		if loaded {
+			wait := e.poll(iterationCtx, logger, config, provider)
+			sleep(iterationCtx, wait)
+		}
+
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// poll performs a single iteration and returns how long to wait before the
+// next one
+func (e *Exporter) poll(ctx context.Context, logger zerolog.Logger, config exporterconfig.Config, provider *localendpoints.Provider) time.Duration {
+	configLabel := config.Name
+	if config.Namespace != "" {
+		configLabel = config.Namespace + "/" + config.Name
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		logger.Error().Err(err).Msgf("error while building series, keeping generation %d, trying again in 5s...", e.collector.Current().Generation())
+		e.pollFailed(configLabel, "", err)
+		return 5 * time.Second
+	}
+	builder.helps, builder.helpsOwner = e.helps, e.collector
+	e.helps.Start(e.collector)
+
+	start := time.Now()
+	response, err := makeAPIRequest(ctx, config, provider, builder, func() {
+		e.metrics.httpRetries.WithLabelValues(configLabel).Inc()
+	})
+	if ctx.Err() != nil {
+		// Interrupted by a configuration change or by shutdown
+		return 0
+	}
+	e.updateStatus(func(status *Status) {
+		status.LastPoll = &start
+		status.ContentType = response.contentType
+		status.Handler = response.handler
+		status.Route = response.route
+	})
+	if err != nil {
+		wait := failureWait(config)
+		logger.Error().Err(err).Msgf("error while polling, keeping generation %d, trying again in %s...", e.collector.Current().Generation(), wait)
+		e.pollFailed(configLabel, response.handler, err)
+		return wait
+	}
+	e.metrics.records.WithLabelValues(configLabel, response.handler).Observe(float64(builder.records))
+	e.metrics.recordsSkipped.WithLabelValues(configLabel, response.handler).Add(float64(builder.skipped))
+
+	snapshot := builder.snapshot
+	previous := e.collector.Current()
+	if err := e.collector.Publish(snapshot); err != nil {
+		logger.Error().Err(err).Msg("error while publishing snapshot")
+		e.pollFailed(configLabel, response.handler, err)
+		return 5 * time.Second
+	}
+	e.helps.Publish(e.collector)
+	logger.Info().Msgf("Published generation %d with %d series from %d pages", snapshot.Generation(), snapshot.Len(), response.pages)
+
+	added, removed := snapshot.Diff(previous)
+	e.metrics.seriesAdded.WithLabelValues(configLabel).Add(float64(added))
+	e.metrics.seriesRemoved.WithLabelValues(configLabel).Add(float64(removed))
+	e.metrics.series.WithLabelValues(configLabel).Set(float64(snapshot.Len()))
+	e.metrics.pollDuration.WithLabelValues(configLabel, response.handler).Observe(time.Since(start).Seconds())
+
+	e.updateStatus(func(status *Status) {
+		status.LastSuccess = &start
+		status.LastError = ""
+		status.Records = builder.records
+		status.RenamedColumns = builder.renamed
+	})
+
+	logger.Debug().Msgf("Polling interval set to %s, starting sleep...", config.Spec.ExporterConfig.PollingInterval.Duration.String())
+	return config.Spec.ExporterConfig.PollingInterval.Duration
+}
+
+func (e *Exporter) pollFailed(configLabel string, handler string, err error) {
+	e.metrics.pollErrors.WithLabelValues(configLabel, handler).Inc()
+	e.updateStatus(func(status *Status) {
+		status.LastError = err.Error()
+	})
+}
+
+// startProvider creates the endpoint provider of the configuration and starts
+// watching its Secret, the returned function stops the watch
+func startProvider(ctx context.Context, config exporterconfig.Config) (*localendpoints.Provider, context.CancelFunc) {
+	rc, _ := rest.InClusterConfig()
+	provider := localendpoints.NewProvider(rc, config.Spec.ExporterConfig.API.EndpointRef, config.Spec.ExporterConfig.AdditionalVariables)
+	watchCtx, cancel := context.WithCancel(ctx)
+	go provider.Watch(watchCtx)
+	return provider, cancel
+}
+
+// failureWait returns how long to wait before polling again after a failed
+// request: the maximum backoff, unless the polling interval is shorter
+func failureWait(config exporterconfig.Config) time.Duration {
+	wait := config.Options.Retry.MaxBackoff
+	if interval := config.Spec.ExporterConfig.PollingInterval.Duration; interval > 0 {
+		wait = min(wait, interval)
+	}
+	return wait
+}
+
+// sleep waits for the given duration, it returns false if the context is
+// cancelled in the meantime
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const selfMetricsNamespace = "finops_exporter"
+
+// Metrics are the self-metrics describing the behaviour of the exporters,
+// they are registered on a registry separate from the exported data.
+type Metrics struct {
+	pollDuration   *prometheus.HistogramVec
+	pollErrors     *prometheus.CounterVec
+	httpRetries    *prometheus.CounterVec
+	records        *prometheus.HistogramVec
+	recordsSkipped *prometheus.CounterVec
+	seriesAdded    *prometheus.CounterVec
+	seriesRemoved  *prometheus.CounterVec
+	series         *prometheus.GaugeVec
+}
+
+func NewMetrics(registerer prometheus.Registerer) *Metrics {
+	m := &Metrics{
+		pollDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "poll_duration_seconds",
+			Help:      "Duration of a poll, from the API request to the publication of the series.",
+			Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+		}, []string{"config", "handler"}),
+		pollErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "poll_errors_total",
+			Help:      "Number of polls that failed, the previous series stay published.",
+		}, []string{"config", "handler"}),
+		httpRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "http_retries_total",
+			Help:      "Number of API requests retried after a failure.",
+		}, []string{"config"}),
+		records: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "records",
+			Help:      "Number of records read from the API response in a poll.",
+			Buckets:   prometheus.ExponentialBuckets(1, 10, 8),
+		}, []string{"config", "handler"}),
+		recordsSkipped: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "records_skipped_total",
+			Help:      "Number of records skipped because their value could not be parsed or the series was invalid.",
+		}, []string{"config", "handler"}),
+		seriesAdded: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "series_added_total",
+			Help:      "Number of series added by the published snapshots.",
+		}, []string{"config"}),
+		seriesRemoved: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "series_removed_total",
+			Help:      "Number of series removed by the published snapshots.",
+		}, []string{"config"}),
+		series: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: selfMetricsNamespace,
+			Name:      "series",
+			Help:      "Number of series currently published.",
+		}, []string{"config"}),
+	}
+	registerer.MustRegister(
+		m.pollDuration,
+		m.pollErrors,
+		m.httpRetries,
+		m.records,
+		m.recordsSkipped,
+		m.seriesAdded,
+		m.seriesRemoved,
+		m.series,
+	)
+	return m
+}
@@ -0,0 +1,154 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+// nextPagePath returns the path of the page following the one requested with
+// path, according to the pagination strategy. It returns false when there
+// are no more pages.
+func nextPagePath(pagination exporterconfig.Pagination, serverURL string, path string, body []byte, header http.Header, pageRecords int) (string, bool, error) {
+	switch pagination.Type {
+	case exporterconfig.PaginationNextLink:
+		link, ok := lookupJSONString(body, pagination.NextLinkPath)
+		if !ok {
+			return "", false, nil
+		}
+		next, err := relativeToServer(serverURL, path, link)
+		return next, err == nil, err
+	case exporterconfig.PaginationLinkHeader:
+		link, ok := parseLinkHeader(header.Values("Link"), "next")
+		if !ok {
+			return "", false, nil
+		}
+		next, err := relativeToServer(serverURL, path, link)
+		return next, err == nil, err
+	case exporterconfig.PaginationToken:
+		token, ok := lookupJSONString(body, pagination.TokenPath)
+		if !ok {
+			return "", false, nil
+		}
+		next, err := withQueryParams(path, map[string]string{pagination.TokenParam: token})
+		return next, err == nil, err
+	case exporterconfig.PaginationOffset:
+		// A short page is the last one
+		if pageRecords < pagination.Limit {
+			return "", false, nil
+		}
+		u, err := url.Parse(path)
+		if err != nil {
+			return "", false, err
+		}
+		offset, _ := strconv.Atoi(u.Query().Get(pagination.OffsetParam))
+		next, err := withQueryParams(path, map[string]string{
+			pagination.OffsetParam: strconv.Itoa(offset + pageRecords),
+			pagination.LimitParam:  strconv.Itoa(pagination.Limit),
+		})
+		return next, err == nil, err
+	}
+	return "", false, nil
+}
+
+// firstPagePath returns the path of the first page
+func firstPagePath(pagination exporterconfig.Pagination, path string) (string, error) {
+	if pagination.Type != exporterconfig.PaginationOffset {
+		return path, nil
+	}
+	return withQueryParams(path, map[string]string{
+		pagination.OffsetParam: "0",
+		pagination.LimitParam:  strconv.Itoa(pagination.Limit),
+	})
+}
+
+// lookupJSONString returns the string found at the dot separated path of the
+// JSON document, false if it is missing, null or empty
+func lookupJSONString(body []byte, path string) (string, bool) {
+	var current any
+	if err := json.Unmarshal(body, &current); err != nil {
+		return "", false
+	}
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+		current = object[key]
+	}
+	value, ok := current.(string)
+	return value, ok && value != ""
+}
+
+// parseLinkHeader returns the target of the link with the given relation in
+// RFC 5988 Link headers, e.g., <https://api/items?page=2>; rel="next"
+func parseLinkHeader(values []string, rel string) (string, bool) {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				key, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+				if !ok || !strings.EqualFold(strings.TrimSpace(key), "rel") {
+					continue
+				}
+				for _, r := range strings.Fields(strings.Trim(strings.TrimSpace(val), `"`)) {
+					if strings.EqualFold(r, rel) {
+						return target[1 : len(target)-1], true
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// relativeToServer converts a link, absolute or relative to the current page,
+// into a path relative to the server URL of the endpoint. Links to other
+// servers are refused, since the credentials of the endpoint would be sent.
+func relativeToServer(serverURL string, currentPath string, link string) (string, error) {
+	server, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil {
+		return "", err
+	}
+	current, err := url.Parse(strings.TrimSuffix(serverURL, "/") + "/" + strings.TrimPrefix(currentPath, "/"))
+	if err != nil {
+		return "", err
+	}
+	target, err := url.Parse(link)
+	if err != nil {
+		return "", fmt.Errorf("invalid next page link %q: %w", link, err)
+	}
+	target = current.ResolveReference(target)
+
+	if !strings.EqualFold(target.Host, server.Host) || !strings.HasPrefix(target.Path, server.Path) {
+		return "", fmt.Errorf("next page link %q does not belong to server %s", link, serverURL)
+	}
+	path := strings.TrimPrefix(target.Path, server.Path)
+	if target.RawQuery != "" {
+		path += "?" + target.RawQuery
+	}
+	return path, nil
+}
+
+// withQueryParams sets the given query parameters of the path
+func withQueryParams(path string, params map[string]string) (string, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	for k, v := range params {
+		query.Set(k, v)
+	}
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,135 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestMakeAPIRequestPagination(t *testing.T) {
+	// Three pages of generic JSON, the second one with an additional column
+	pages := []string{
+		`{"value": [{"id": "a", "cost": 1}, {"id": "b", "cost": 2}]`,
+		`{"value": [{"id": "c", "cost": 3, "region": "eu"}, {"id": "d", "cost": 4, "region": "us"}]`,
+		`{"value": [{"id": "e", "cost": 5}]`,
+	}
+
+	tests := []struct {
+		name       string
+		pagination exporterconfig.Pagination
+		// page returns the index of the requested page and the pagination
+		// fields to add to the response
+		page func(r *http.Request, serverURL string) (int, string, http.Header)
+		// expected is the number of records, without header
+		expected int
+	}{
+		{
+			name:       "next link",
+			pagination: exporterconfig.Pagination{Type: exporterconfig.PaginationNextLink, NextLinkPath: "properties.nextLink"},
+			page: func(r *http.Request, serverURL string) (int, string, http.Header) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("skiptoken"))
+				if page+1 < len(pages) {
+					return page, fmt.Sprintf(`, "properties": {"nextLink": "%s/costs?skiptoken=%d"}`, serverURL, page+1), nil
+				}
+				return page, `, "properties": {"nextLink": null}`, nil
+			},
+			expected: 5,
+		},
+		{
+			name:       "token",
+			pagination: exporterconfig.Pagination{Type: exporterconfig.PaginationToken, TokenPath: "NextToken", TokenParam: "nextToken"},
+			page: func(r *http.Request, serverURL string) (int, string, http.Header) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("nextToken"))
+				if page+1 < len(pages) {
+					return page, fmt.Sprintf(`, "NextToken": "%d"`, page+1), nil
+				}
+				return page, "", nil
+			},
+			expected: 5,
+		},
+		{
+			name:       "link header",
+			pagination: exporterconfig.Pagination{Type: exporterconfig.PaginationLinkHeader},
+			page: func(r *http.Request, serverURL string) (int, string, http.Header) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				header := http.Header{}
+				if page+1 < len(pages) {
+					header.Set("Link", fmt.Sprintf(`</costs?page=%d>; rel="next", </costs?page=0>; rel="first"`, page+1))
+				}
+				return page, "", header
+			},
+			expected: 5,
+		},
+		{
+			name:       "offset",
+			pagination: exporterconfig.Pagination{Type: exporterconfig.PaginationOffset, OffsetParam: "offset", LimitParam: "limit", Limit: 2},
+			page: func(r *http.Request, serverURL string) (int, string, http.Header) {
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				return offset / 2, "", nil
+			},
+			expected: 5,
+		},
+		{
+			name:       "max pages",
+			pagination: exporterconfig.Pagination{Type: exporterconfig.PaginationToken, TokenPath: "NextToken", TokenParam: "nextToken", MaxPages: 2},
+			page: func(r *http.Request, serverURL string) (int, string, http.Header) {
+				page, _ := strconv.Atoi(r.URL.Query().Get("nextToken"))
+				return page, fmt.Sprintf(`, "NextToken": "%d"`, (page+1)%len(pages)), nil
+			},
+			expected: 4,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var server *httptest.Server
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				page, fields, header := tc.page(r, server.URL)
+				for k, v := range header {
+					w.Header()[k] = v
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(pages[page] + fields + "}"))
+			}))
+			defer server.Close()
+
+			config := exporterconfig.Config{}
+			config.Spec.ExporterConfig.MetricType = "generic"
+			config.Spec.ExporterConfig.Generic = &finopsdatatypes.Generic{ValueColumnIndex: 0, MetricName: "cost"}
+			config.Spec.ExporterConfig.API.Path = "/costs"
+			config.Options.Retry = exporterconfig.Retry{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			config.Options.Pagination = tc.pagination
+			if config.Options.Pagination.MaxPages == 0 {
+				config.Options.Pagination.MaxPages = exporterconfig.DefaultMaxPages
+			}
+
+			builder, err := newSnapshotBuilder(config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if _, err := makeAPIRequest(context.Background(), config, newTestProvider(server.URL), builder, func() {}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if builder.records != tc.expected || builder.snapshot.Len() != tc.expected {
+				t.Fatalf("expected %d records and series, got %d records and %d series", tc.expected, builder.records, builder.snapshot.Len())
+			}
+		})
+	}
+}
+
+func TestRelativeToServer(t *testing.T) {
+	path, err := relativeToServer("https://management.azure.com/", "/subscriptions/x/query?api-version=1", "https://management.azure.com/subscriptions/x/query?api-version=1&$skiptoken=abc")
+	if err != nil || path != "/subscriptions/x/query?api-version=1&$skiptoken=abc" {
+		t.Fatalf("unexpected result %q, %v", path, err)
+	}
+	if _, err := relativeToServer("https://management.azure.com", "/query", "https://attacker.example.com/query"); err == nil {
+		t.Fatal("expected links to other servers to be refused")
+	}
+}
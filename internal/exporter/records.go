@@ -0,0 +1,548 @@
+package exporter
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/collector"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/names"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/relabel"
+)
+
+const (
+	// Labels added to every series to identify the originating configuration
+	ConfigNameLabel      = "exporter_config_name"
+	ConfigNamespaceLabel = "exporter_config_namespace"
+)
+
+// snapshotBuilder converts records into the series of a new snapshot
+// according to the metric type of the configuration, one record at a time.
+type snapshotBuilder struct {
+	config     exporterconfig.Config
+	metricType string
+	snapshot   *collector.Snapshot
+
+	header     []string
+	labelNames []string
+	// values are the columns exported as metrics, the other columns are
+	// labels
+	values []valueColumn
+	// unitIndex is the column of the units normalized, -1 if the units are
+	// not normalized
+	unitIndex int
+	// renamed maps the columns to their labels, when the name of the column
+	// is not a valid label name or is already taken
+	renamed map[string]string
+	// labelColumns marks the columns that become labels
+	labelColumns []bool
+	// includeRegex and excludeRegex select the label columns by name
+	includeRegex *regexp.Regexp
+	excludeRegex *regexp.Regexp
+	// relabelings rewrite the labels of each record
+	relabelings []*relabel.Rule
+	// nameTemplate and helpTemplate render the names and the help texts of
+	// the metrics, helps keeps the first help text of each metric name and
+	// is shared by the exporters of the same registry, for the snapshots of
+	// helpsOwner
+	nameTemplate *template.Template
+	helpTemplate *template.Template
+	helps        *collector.Helps
+	helpsOwner   *collector.Collector
+	// tagsReplacer formats the values of the Tags columns
+	tagsReplacer *strings.Replacer
+	// tagLabels maps the tags to their labels when the Tags columns are
+	// exploded, up to maxTagKeys tags
+	tagLabels  map[string]string
+	tagPrefix  string
+	maxTagKeys int
+	tagsCapped bool
+
+	// records and skipped count the records read and the ones that could not
+	// be exported, the records dropped by the relabelings are not skipped
+	records int
+	skipped int
+}
+
+// valueColumn is a column exported as a metric. The metric name is derived
+// from the metric type when it is empty.
+type valueColumn struct {
+	index      int
+	metricName string
+}
+
+func newSnapshotBuilder(config exporterconfig.Config) (*snapshotBuilder, error) {
+	b := &snapshotBuilder{
+		config:       config,
+		metricType:   strings.ToLower(config.Spec.ExporterConfig.MetricType),
+		snapshot:     collector.NewSnapshot(),
+		tagsReplacer: strings.NewReplacer("{", "", "}", "", "=", ":", ",", ";", "\"", ""),
+		tagLabels:    map[string]string{},
+		renamed:      map[string]string{},
+		helps:        collector.NewHelps(),
+		tagPrefix:    config.Options.Tags.Prefix,
+		maxTagKeys:   config.Options.Tags.MaxKeys,
+	}
+	if b.tagPrefix == "" {
+		b.tagPrefix = exporterconfig.DefaultTagPrefix
+	}
+	if b.maxTagKeys <= 0 {
+		b.maxTagKeys = exporterconfig.DefaultMaxTagKeys
+	}
+	switch b.metricType {
+	case "cost", "resource":
+	case "generic":
+		if config.Spec.ExporterConfig.Generic == nil {
+			return nil, fmt.Errorf("generic object cannot be null with generic metric type")
+		}
+	default:
+		return nil, fmt.Errorf("unknow metric type: %s", config.Spec.ExporterConfig.MetricType)
+	}
+
+	var err error
+	if b.includeRegex, err = exporterconfig.CompileRegex(config.Options.Labels.IncludeRegex); err != nil {
+		return nil, fmt.Errorf("invalid includeRegex: %w", err)
+	}
+	if b.excludeRegex, err = exporterconfig.CompileRegex(config.Options.Labels.ExcludeRegex); err != nil {
+		return nil, fmt.Errorf("invalid excludeRegex: %w", err)
+	}
+	for i, relabeling := range config.Options.Relabelings {
+		rule, err := relabel.Compile(relabeling)
+		if err != nil {
+			return nil, fmt.Errorf("invalid relabeling %d: %w", i, err)
+		}
+		b.relabelings = append(b.relabelings, rule)
+	}
+	if metric := config.Options.Metric; metric.Name != "" {
+		if b.nameTemplate, err = names.ParseTemplate("name", metric.Name); err != nil {
+			return nil, fmt.Errorf("invalid metric name template: %w", err)
+		}
+	}
+	if metric := config.Options.Metric; metric.Help != "" {
+		if b.helpTemplate, err = names.ParseTemplate("help", metric.Help); err != nil {
+			return nil, fmt.Errorf("invalid metric help template: %w", err)
+		}
+	}
+	return b, nil
+}
+
+// setHeader sets the header of the records that follow, every page of the
+// response starts with its own header
+func (b *snapshotBuilder) setHeader(header []string) error {
+	b.header = header
+	if err := b.setValues(header); err != nil {
+		return err
+	}
+	b.unitIndex = -1
+	if b.metricType == "resource" && b.config.Options.Metric.NormalizeUnits {
+		b.unitIndex = columnIndex(header, "unit")
+	}
+
+	labels := b.config.Options.Labels
+	b.labelColumns = make([]bool, len(header))
+	for i, column := range header {
+		b.labelColumns[i] = b.isLabel(column)
+	}
+	// The unit column contradicts the normalized values, it stays a label
+	// only when explicitly included
+	if b.unitIndex >= 0 && !b.isIncluded(header[b.unitIndex]) {
+		b.labelColumns[b.unitIndex] = false
+	}
+	if !labels.KeepValueColumns {
+		for _, value := range b.values {
+			if value.index >= 0 && value.index < len(header) {
+				b.labelColumns[value.index] = false
+			}
+		}
+	}
+
+	// The names of the label columns are made valid and unique, the columns
+	// renamed by the options and the ones with a valid name keep their name
+	var columns, labelNames []string
+	var preferred []bool
+	for i, column := range header {
+		if !b.labelColumns[i] {
+			continue
+		}
+		name, renamed := lookupFold(labels.Rename, column)
+		if !renamed {
+			name = names.Sanitize(column)
+		}
+		columns = append(columns, column)
+		labelNames = append(labelNames, name)
+		preferred = append(preferred, renamed || name == column)
+	}
+	requested := slices.Clone(labelNames)
+	names.Dedupe(labelNames, preferred, ConfigNameLabel, ConfigNamespaceLabel)
+	for j, column := range columns {
+		if labelNames[j] != requested[j] || !preferred[j] {
+			if _, ok := b.renamed[column]; !ok {
+				log.Logger.Debug().Msgf("column %s exported as label %s", column, labelNames[j])
+			}
+			b.renamed[column] = labelNames[j]
+		}
+	}
+
+	b.labelNames = make([]string, len(header))
+	j := 0
+	for i := range header {
+		if b.labelColumns[i] {
+			b.labelNames[i] = labelNames[j]
+			j++
+		}
+	}
+	return nil
+}
+
+// isLabel tells whether the column becomes a label according to the labels
+// of the options, the FOCUS custom columns (x_) are never labels of cost
+// metrics
+func (b *snapshotBuilder) isLabel(column string) bool {
+	if b.metricType == "cost" && strings.HasPrefix(column, "x_") {
+		return false
+	}
+	labels := b.config.Options.Labels
+	if (len(labels.Include) > 0 || b.includeRegex != nil) && !b.isIncluded(column) {
+		return false
+	}
+	if containsFold(labels.Exclude, column) || (b.excludeRegex != nil && b.excludeRegex.MatchString(column)) {
+		return false
+	}
+	return true
+}
+
+// isIncluded tells whether the column is explicitly included by the labels of
+// the options
+func (b *snapshotBuilder) isIncluded(column string) bool {
+	return containsFold(b.config.Options.Labels.Include, column) || (b.includeRegex != nil && b.includeRegex.MatchString(column))
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupFold returns the value of the key, matched exactly or, when no key
+// matches exactly, case insensitively
+func lookupFold(m map[string]string, key string) (string, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	for k, value := range m {
+		if strings.EqualFold(k, key) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// setValues selects the value columns of the header
+func (b *snapshotBuilder) setValues(header []string) error {
+	if values := b.config.Options.Values; len(values) > 0 {
+		b.values = b.values[:0]
+		for _, value := range values {
+			index := columnIndex(header, value.Column)
+			if index == -1 {
+				log.Logger.Warn().Msgf("value column %s not found, metric %s not exported", value.Column, value.MetricName)
+				continue
+			}
+			b.values = append(b.values, valueColumn{index: index, metricName: value.MetricName})
+		}
+		if len(b.values) == 0 {
+			return fmt.Errorf("error while selecting value columns: none of the value columns found")
+		}
+		return nil
+	}
+
+	// Obtain various indexes
+	// BilledCost for value of metric
+	valueIndex := -1
+	switch b.metricType {
+	case "cost":
+		for i, column := range header {
+			if strings.EqualFold(column, "BilledCost") {
+				valueIndex = i
+				break
+			}
+		}
+		if valueIndex == -1 {
+			return fmt.Errorf("error while selecting column BilledCost: BilledCost not found")
+		}
+	case "resource":
+		valueIndex = 3
+	case "generic":
+		valueIndex = b.config.Spec.ExporterConfig.Generic.ValueColumnIndex
+		if name := b.config.Options.Generic.ValueColumn; name != "" {
+			valueIndex = columnIndex(header, name)
+			if valueIndex == -1 {
+				return fmt.Errorf("error while selecting value column: %s not found", name)
+			}
+		}
+	}
+	b.values = []valueColumn{{index: valueIndex}}
+	return nil
+}
+
+// columnIndex returns the index of the column with the given name, matched
+// exactly or, when no column matches exactly, case insensitively. It returns
+// -1 when the column is not found.
+func columnIndex(header []string, name string) int {
+	for i, column := range header {
+		if column == name {
+			return i
+		}
+	}
+	for i, column := range header {
+		if strings.EqualFold(column, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// add converts a record into a series of the snapshot for each value column,
+// records that cannot be converted are skipped
+func (b *snapshotBuilder) add(record []string) {
+	b.records++
+
+	if len(record) != len(b.header) {
+		log.Logger.Warn().Msgf("skipping this record for this iteration, %d fields with a header of %d columns", len(record), len(b.header))
+		b.skipped++
+		return
+	}
+
+	labels := prometheus.Labels{}
+	var tags []string
+	for j, value := range record {
+		isTags := strings.Contains(b.header[j], "Tags")
+		if isTags && b.config.Options.Tags.Explode && !b.isValueColumn(j) {
+			tags = append(tags, value)
+			if !b.config.Options.Tags.KeepColumn {
+				continue
+			}
+		}
+		if !b.labelColumns[j] {
+			continue
+		}
+		if !isTags {
+			labels[b.labelNames[j]] = value
+		} else {
+			labels[b.labelNames[j]] = b.tagsReplacer.Replace(value)
+		}
+	}
+	// The tags do not replace the labels of the columns
+	for _, value := range tags {
+		b.addTags(labels, value)
+	}
+	if len(b.relabelings) > 0 && !relabel.Process(labels, b.relabelings) {
+		log.Logger.Debug().Msg("record dropped by the relabelings")
+		return
+	}
+	labels[ConfigNameLabel] = b.config.Name
+	labels[ConfigNamespaceLabel] = b.config.Namespace
+
+	var data map[string]interface{}
+	if b.nameTemplate != nil || b.helpTemplate != nil {
+		data = b.templateData(record)
+	}
+
+	added := 0
+	for _, value := range b.values {
+		if value.index < 0 || value.index >= len(record) {
+			log.Logger.Warn().Msgf("value column %d out of range", value.index)
+			continue
+		}
+		if len(b.values) > 1 && strings.TrimSpace(record[value.index]) == "" {
+			// e.g., the ConsumedQuantity of purchases, the other values are exported
+			continue
+		}
+		metricValue, err := parseValue(record[value.index], b.config.Options.DecimalSeparator)
+		if err != nil {
+			log.Logger.Warn().Err(err).Msgf("error while parsing metric value: %s", record[value.index])
+			continue
+		}
+		unit := b.config.Options.Metric.Unit
+		if b.unitIndex >= 0 && b.unitIndex < len(record) {
+			if normalized, ok := normalizeUnit(record[b.unitIndex]); ok {
+				unit = normalized.name
+				metricValue *= normalized.factor
+			} else {
+				log.Logger.Debug().Msgf("unknown unit %s, the value is not converted", record[b.unitIndex])
+			}
+		}
+		name, help, err := b.describe(value, record, data, unit)
+		if err != nil {
+			log.Logger.Warn().Err(err).Msg("error while rendering the metric name")
+			continue
+		}
+		if err := b.snapshot.Add(name, help, labels, metricValue); err != nil {
+			log.Logger.Warn().Err(err).Msg("error while adding the series")
+			continue
+		}
+		if unit != "" {
+			b.snapshot.SetUnit(name, unit)
+		}
+		added++
+	}
+	if added == 0 {
+		log.Logger.Warn().Msg("skipping this record for this iteration, no value exported")
+		b.skipped++
+	}
+}
+
+// isValueColumn tells whether the column is exported as a metric
+func (b *snapshotBuilder) isValueColumn(index int) bool {
+	for _, value := range b.values {
+		if value.index == index {
+			return true
+		}
+	}
+	return false
+}
+
+// templateConfig is the configuration available to the templates
+type templateConfig struct {
+	Name       string
+	Namespace  string
+	MetricType string
+	Variables  map[string]string
+}
+
+// templateValue is the value column available to the templates
+type templateValue struct {
+	Column     string
+	MetricName string
+	Unit       string
+}
+
+// templateData returns the data of the templates for the record: the columns
+// by name, the configuration as Config and the value column as Value
+func (b *snapshotBuilder) templateData(record []string) map[string]interface{} {
+	data := make(map[string]interface{}, len(record)+2)
+	for i, value := range record {
+		data[b.header[i]] = value
+	}
+	data["Config"] = templateConfig{
+		Name:       b.config.Name,
+		Namespace:  b.config.Namespace,
+		MetricType: b.metricType,
+		Variables:  b.config.Spec.ExporterConfig.AdditionalVariables,
+	}
+	return data
+}
+
+// describe returns the name and the help text of the metric of the value
+// column for the record, in the given unit. A metric name keeps the help text
+// of its first series, also across the exporters, since all the series of a
+// metric share it.
+func (b *snapshotBuilder) describe(value valueColumn, record []string, data map[string]interface{}, unit string) (string, string, error) {
+	name := b.metricName(value, record)
+	if data != nil {
+		column := ""
+		if value.index >= 0 && value.index < len(b.header) {
+			column = b.header[value.index]
+		}
+		data["Value"] = templateValue{Column: column, MetricName: name, Unit: unit}
+	}
+	if b.nameTemplate != nil {
+		rendered, err := execute(b.nameTemplate, data)
+		if err != nil {
+			return "", "", err
+		}
+		if rendered == "" {
+			return "", "", fmt.Errorf("empty metric name")
+		}
+		name = rendered
+	}
+	if b.nameTemplate != nil || unit != "" {
+		name = names.Metric(name, unit)
+	}
+
+	help, ok := b.helps.Get(b.helpsOwner, name)
+	if !ok {
+		if b.helpTemplate != nil {
+			rendered, err := execute(b.helpTemplate, data)
+			if err != nil {
+				return "", "", err
+			}
+			help = rendered
+		}
+		help = b.helps.Resolve(b.helpsOwner, name, help)
+	}
+	return name, help, nil
+}
+
+func execute(tmpl *template.Template, data map[string]interface{}) (string, error) {
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(rendered.String()), nil
+}
+
+// metricName returns the name of the metric of the value column for the
+// record
+func (b *snapshotBuilder) metricName(value valueColumn, record []string) string {
+	if value.metricName != "" {
+		return value.metricName
+	}
+	switch b.metricType {
+	case "cost":
+		return "billed_cost"
+	case "resource":
+		if len(record) > 1 {
+			return names.Sanitize(strings.ReplaceAll(strings.ToLower(record[1]), " ", "_"))
+		}
+	case "generic":
+		return names.Sanitize(b.config.Spec.ExporterConfig.Generic.MetricName)
+	}
+	return ""
+}
+
+// readRecords reads CSV data row by row into the builder, the first row is
+// the header. It returns the number of records read.
+func readRecords(data io.Reader, b *snapshotBuilder) (int, error) {
+	reader := csv.NewReader(data)
+	reader.LazyQuotes = true
+	// Ragged records are skipped by the builder instead of failing the poll
+	reader.FieldsPerRecord = -1
+	// Rows are converted immediately, the slice can be reused
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error while reading header: %w", err)
+	}
+	if err := b.setHeader(append([]string(nil), header...)); err != nil {
+		return 0, err
+	}
+
+	read := 0
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return read, nil
+		}
+		if err != nil {
+			return read, fmt.Errorf("error while reading file: %w", err)
+		}
+		b.add(record)
+		read++
+	}
+}
@@ -0,0 +1,492 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/collector"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	binaryhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/binary"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/relabel"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/utils"
+)
+
+func TestReadRecordsCost(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Name = "focus"
+	config.Namespace = "finops"
+	config.Spec.ExporterConfig.MetricType = "cost"
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "\xef\xbb\xbfResourceId,BilledCost,Tags,x_Internal\n" +
+		"vm-1,1.5,\"{\"\"team\"\"=\"\"x\"\",\"\"env\"\"=\"\"prod\"\"}\",a\n" +
+		"vm-2,not-a-number,,b\n"
+	read, err := readRecords(utils.SkipBOM(strings.NewReader(data)), builder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if read != 2 || builder.records != 2 || builder.skipped != 1 {
+		t.Fatalf("expected 2 records with 1 skipped, got %d read, %d records, %d skipped", read, builder.records, builder.skipped)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",Tags="team:x;env:prod",exporter_config_name="focus",exporter_config_namespace="finops"} 1.5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRecordsGzipStream(t *testing.T) {
+	const rows = 10000
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	fmt.Fprintln(gw, "ResourceId,metricName,timestamp,average,unit")
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(gw, "vm-%d,Percentage CPU,2024-01-01T00:00:00Z,%d,Percent\n", i, i%100)
+	}
+	gw.Close()
+
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "resource"
+	config.Spec.ExporterConfig.API.Path = "/jsonapi/export?format=json"
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	data, route, err := resolveStream(config, &binaryhandler.BinaryHandler{}, &compressed)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if route != "gzip > csv" {
+		t.Errorf("expected route gzip > csv, got %q", route)
+	}
+	if _, err := readRecords(data, builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if builder.snapshot.Len() != rows {
+		t.Fatalf("expected %d series, got %d", rows, builder.snapshot.Len())
+	}
+}
+
+func newTestCollector(t *testing.T, builder *snapshotBuilder) prometheus.Collector {
+	t.Helper()
+	e := New("config.yaml", NewMetrics(prometheus.NewRegistry()), collector.NewHelps())
+	if err := e.Collector().Publish(builder.snapshot); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return e.Collector()
+}
+
+func TestReadRecordsValueColumn(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "generic"
+	config.Spec.ExporterConfig.Generic = &finopsdatatypes.Generic{ValueColumnIndex: 0, MetricName: "cost"}
+	config.Options.Generic.ValueColumn = "Cost"
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "account,cost\n" +
+		"a,\"$1,234.50\"\n" +
+		"b,\"(12,50 EUR)\"\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP cost 
+# TYPE cost gauge
+cost{account="a",exporter_config_name="",exporter_config_namespace=""} 1234.5
+cost{account="b",exporter_config_name="",exporter_config_namespace=""} -12.5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Options.Generic.ValueColumn = "missing"
+	builder, err = newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := readRecords(strings.NewReader(data), builder); err == nil {
+		t.Fatal("expected an error for a missing value column")
+	}
+}
+
+func TestReadRecordsValues(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Values = []exporterconfig.ValueColumn{
+		{Column: "BilledCost", MetricName: "billed_cost"},
+		{Column: "EffectiveCost", MetricName: "effective_cost"},
+		{Column: "ConsumedQuantity", MetricName: "consumed_quantity"},
+		{Column: "ContractedCost", MetricName: "contracted_cost"},
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,BilledCost,EffectiveCost,ConsumedQuantity\n" +
+		"vm-1,1.5,1.2,10\n" +
+		"reservation,100,0,\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if builder.skipped != 0 {
+		t.Fatalf("expected no skipped records, got %d", builder.skipped)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="reservation",exporter_config_name="",exporter_config_namespace=""} 100
+billed_cost{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 1.5
+# HELP consumed_quantity 
+# TYPE consumed_quantity gauge
+consumed_quantity{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 10
+# HELP effective_cost 
+# TYPE effective_cost gauge
+effective_cost{ResourceId="reservation",exporter_config_name="",exporter_config_namespace=""} 0
+effective_cost{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 1.2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRecordsLabels(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Labels = exporterconfig.Labels{
+		IncludeRegex: "Resource.*|Service.*|Billed.*",
+		Exclude:      []string{"resourcetype"},
+		Rename:       map[string]string{"ResourceId": "resource_id"},
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,ResourceType,ServiceName,InvoiceId,BilledCost\n" +
+		"vm-1,vm,compute,inv-1,1.5\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ServiceName="compute",exporter_config_name="",exporter_config_namespace="",resource_id="vm-1"} 1.5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Options.Labels = exporterconfig.Labels{Include: []string{"ResourceId", "BilledCost"}, KeepValueColumns: true}
+	builder, err = newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c = newTestCollector(t, builder)
+	expected = `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{BilledCost="1.5",ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 1.5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRecordsRelabelings(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Relabelings = []relabel.Config{
+		{SourceLabels: []string{"ChargeCategory"}, Regex: "Tax", Action: relabel.Drop},
+		{SourceLabels: []string{"RegionId"}, TargetLabel: "region", Action: relabel.Lowercase},
+		{Regex: "RegionId|ChargeCategory", Action: relabel.LabelDrop},
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,RegionId,ChargeCategory,BilledCost\n" +
+		"vm-1,EU-West,Usage,1.5\n" +
+		"vm-1,EU-West,Tax,0.3\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if builder.skipped != 0 {
+		t.Fatalf("expected no skipped records, got %d", builder.skipped)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace="",region="eu-west"} 1.5
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRecordsLabelNames(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "generic"
+	config.Spec.ExporterConfig.Generic = &finopsdatatypes.Generic{MetricName: "cost"}
+	config.Options.Generic.ValueColumn = "cost"
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "tags.team,tags_team,0zone,exporter_config_name,cost\n" +
+		"a,b,c,d,1\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP cost 
+# TYPE cost gauge
+cost{_0zone="c",exporter_config_name="",exporter_config_name_2="d",exporter_config_namespace="",tags_team="b",tags_team_2="a"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+	renamed := map[string]string{
+		"tags.team":            "tags_team_2",
+		"0zone":                "_0zone",
+		"exporter_config_name": "exporter_config_name_2",
+	}
+	if !reflect.DeepEqual(builder.renamed, renamed) {
+		t.Errorf("expected renamed columns %v, got %v", renamed, builder.renamed)
+	}
+}
+
+func TestReadRecordsMetricTemplates(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Name = "vm"
+	config.Spec.ExporterConfig.MetricType = "resource"
+	config.Options.Metric = exporterconfig.Metric{
+		Name: "azure_{{ .metricName | snake }}_{{ .unit | lower }}_total",
+		Help: "{{ .metricName }} of the virtual machines of {{ .Config.Name }}, in {{ .unit }}",
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,metricName,timestamp,average,unit\n" +
+		"vm-1,Percentage CPU,2024-01-01T00:00:00Z,12.5,Percent\n" +
+		"vm-2,Percentage CPU,2024-01-01T00:00:00Z,50,Percent\n" +
+		"vm-1,Data Read,2024-01-01T00:00:00Z,1024,Bytes\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP azure_data_read_bytes Data Read of the virtual machines of vm, in Bytes
+# TYPE azure_data_read_bytes gauge
+azure_data_read_bytes{ResourceId="vm-1",exporter_config_name="vm",exporter_config_namespace="",metricName="Data Read",timestamp="2024-01-01T00:00:00Z",unit="Bytes"} 1024
+# HELP azure_percentage_cpu_percent Percentage CPU of the virtual machines of vm, in Percent
+# TYPE azure_percentage_cpu_percent gauge
+azure_percentage_cpu_percent{ResourceId="vm-1",exporter_config_name="vm",exporter_config_namespace="",metricName="Percentage CPU",timestamp="2024-01-01T00:00:00Z",unit="Percent"} 12.5
+azure_percentage_cpu_percent{ResourceId="vm-2",exporter_config_name="vm",exporter_config_namespace="",metricName="Percentage CPU",timestamp="2024-01-01T00:00:00Z",unit="Percent"} 50
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Options.Metric = exporterconfig.Metric{Name: "{{ .missing }}"}
+	builder, err = newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if builder.skipped != 3 {
+		t.Errorf("expected 3 skipped records, got %d", builder.skipped)
+	}
+}
+
+func TestReadRecordsNormalizeUnits(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "resource"
+	config.Options.Metric.NormalizeUnits = true
+	config.Options.Labels.Include = []string{"ResourceId"}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,metricName,timestamp,average,unit\n" +
+		"vm-1,Percentage CPU,2024-01-01T00:00:00Z,12.5,Percent\n" +
+		"vm-1,Disk Read Bytes,2024-01-01T00:00:00Z,1024,Bytes\n" +
+		"vm-1,Network In,2024-01-01T00:00:00Z,800,BitsPerSecond\n" +
+		"vm-1,Latency,2024-01-01T00:00:00Z,250,MilliSeconds\n" +
+		"vm-1,Requests,2024-01-01T00:00:00Z,7,Count\n" +
+		"vm-1,Other,2024-01-01T00:00:00Z,3,Unspecified\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP disk_read_bytes 
+# TYPE disk_read_bytes gauge
+disk_read_bytes{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 1024
+# HELP latency_seconds 
+# TYPE latency_seconds gauge
+latency_seconds{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 0.25
+# HELP network_in_bytes_per_second 
+# TYPE network_in_bytes_per_second gauge
+network_in_bytes_per_second{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 100
+# HELP other 
+# TYPE other gauge
+other{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 3
+# HELP percentage_cpu_ratio 
+# TYPE percentage_cpu_ratio gauge
+percentage_cpu_ratio{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 0.125
+# HELP requests 
+# TYPE requests gauge
+requests{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace=""} 7
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+	for name, expected := range map[string]string{"percentage_cpu_ratio": "ratio", "disk_read_bytes": "bytes", "latency_seconds": "seconds", "requests": ""} {
+		if unit, _ := builder.snapshot.Unit(name); unit != expected {
+			t.Errorf("%s: expected unit %q, got %q", name, expected, unit)
+		}
+	}
+}
+
+func TestReadRecordsNormalizeUnitsLabels(t *testing.T) {
+	// The unit column is a label only when explicitly included
+	tests := []struct {
+		include []string
+		labels  string
+	}{
+		{labels: `ResourceId="vm-1",exporter_config_name="",exporter_config_namespace="",metricName="Percentage CPU",timestamp="2024-01-01T00:00:00Z"`},
+		{include: []string{"ResourceId", "unit"}, labels: `ResourceId="vm-1",exporter_config_name="",exporter_config_namespace="",unit="Percent"`},
+	}
+	for _, tt := range tests {
+		config := exporterconfig.Config{}
+		config.Spec.ExporterConfig.MetricType = "resource"
+		config.Options.Metric.NormalizeUnits = true
+		config.Options.Labels.Include = tt.include
+
+		builder, err := newSnapshotBuilder(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		data := "ResourceId,metricName,timestamp,average,unit\n" +
+			"vm-1,Percentage CPU,2024-01-01T00:00:00Z,50,Percent\n"
+		if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		c := newTestCollector(t, builder)
+		expected := `
+# HELP percentage_cpu_ratio 
+# TYPE percentage_cpu_ratio gauge
+percentage_cpu_ratio{` + tt.labels + `} 0.5
+`
+		if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+			t.Errorf("include %v: %v", tt.include, err)
+		}
+	}
+}
+
+func TestReadRecordsSharedHelps(t *testing.T) {
+	helps := collector.NewHelps()
+	registry := prometheus.NewRegistry()
+	data := "ResourceId,BilledCost\nvm-1,1.5\n"
+
+	for _, name := range []string{"focus-a", "focus-b", "focus-c"} {
+		config := exporterconfig.Config{}
+		config.Name = name
+		config.Spec.ExporterConfig.MetricType = "cost"
+		if name != "focus-c" {
+			config.Options.Metric.Help = "Billed cost of {{ .Config.Name }}"
+		}
+		builder, err := newSnapshotBuilder(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		c := collector.New()
+		builder.helps, builder.helpsOwner = helps, c
+		if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := c.Publish(builder.snapshot); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		helps.Publish(c)
+		registry.MustRegister(c)
+	}
+
+	expected := `
+# HELP billed_cost Billed cost of focus-a
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",exporter_config_name="focus-a",exporter_config_namespace=""} 1.5
+billed_cost{ResourceId="vm-1",exporter_config_name="focus-b",exporter_config_namespace=""} 1.5
+billed_cost{ResourceId="vm-1",exporter_config_name="focus-c",exporter_config_namespace=""} 1.5
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadRecordsRagged(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,BilledCost\n" +
+		"vm-1,1.5\n" +
+		"vm-2,2,extra\n" +
+		"vm-3\n" +
+		"vm-4,4\n"
+	read, err := readRecords(strings.NewReader(data), builder)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if read != 4 || builder.skipped != 2 || builder.snapshot.Len() != 2 {
+		t.Fatalf("expected 4 records with 2 skipped and 2 series, got %d read, %d skipped, %d series", read, builder.skipped, builder.snapshot.Len())
+	}
+}
@@ -0,0 +1,227 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/http/request"
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers"
+	octethandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/octet"
+	localendpoints "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/endpoints"
+	localrequest "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/http/request"
+	localstatus "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/http/response"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/utils"
+)
+
+// apiResponse describes the outcome of makeAPIRequest: how many pages were
+// requested and how the data was detected
+type apiResponse struct {
+	pages       int
+	contentType string
+	handler     string
+	route       string
+}
+
+// makeAPIRequest requests all the pages of the API according to the
+// pagination of the configuration. Each response is converted by the handler
+// selected by its Content-Type and read row by row into the builder while it
+// is downloaded, so that the whole body is never held in memory, unless the
+// handler or the pagination strategy need the complete document.
+func makeAPIRequest(ctx context.Context, config exporterconfig.Config, provider *localendpoints.Provider, builder *snapshotBuilder, retried func()) (apiResponse, error) {
+	pagination := config.Options.Pagination
+	response := apiResponse{}
+
+	path, err := firstPagePath(pagination, config.Spec.ExporterConfig.API.Path)
+	if err != nil {
+		return response, fmt.Errorf("invalid API path: %w", err)
+	}
+	requested := map[string]struct{}{}
+	for {
+		requested[path] = struct{}{}
+
+		// body is kept only when the next page is read from the response
+		var body []byte
+		var pageRecords int
+		res, err := fetchPage(ctx, config, provider, path, retried, func(respo *http.Response) error {
+			// "Content-Encoding: gzip" is automatically handlded by go's HTTP transport
+			log.Logger.Debug().Msgf("Content-Type: %s", strings.ToLower(respo.Header.Get("Content-Type")))
+			log.Logger.Debug().Msgf("Content-Length: %s", strings.ToLower(respo.Header.Get("Content-Length")))
+
+			response.contentType = strings.ToLower(respo.Header.Get("Content-Type"))
+			handler, err := selectHandler(config.Options, response.contentType)
+			if err != nil {
+				return err
+			}
+			response.handler = reflect.TypeOf(handler).Elem().Name()
+
+			data := utils.SkipBOM(respo.Body)
+			if pagination.Type == exporterconfig.PaginationNextLink || pagination.Type == exporterconfig.PaginationToken {
+				if body, err = io.ReadAll(data); err != nil {
+					return err
+				}
+				data = bytes.NewReader(body)
+			}
+			csvData, route, err := resolveStream(config, handler, data)
+			response.route = route
+			if err != nil {
+				return fmt.Errorf("error resolving data: %w", err)
+			}
+			pageRecords, err = readRecords(csvData, builder)
+			return err
+		})
+		if err != nil {
+			return response, pageError(response.pages, err)
+		}
+		response.pages++
+
+		endpoint, err := provider.Get(ctx)
+		if err != nil {
+			return response, fmt.Errorf("could not resolve endpoint: %w", err)
+		}
+		next, ok, err := nextPagePath(pagination, endpoint.ServerURL, path, body, headerOf(res), pageRecords)
+		if err != nil {
+			return response, pageError(response.pages-1, err)
+		}
+		if !ok {
+			return response, nil
+		}
+		if _, ok := requested[next]; ok {
+			log.Logger.Warn().Msgf("Next page %s already requested, stopping pagination", next)
+			return response, nil
+		}
+		if response.pages >= pagination.MaxPages {
+			log.Logger.Warn().Msgf("Reached the maximum of %d pages per poll, ignoring the following pages", pagination.MaxPages)
+			return response, nil
+		}
+		log.Logger.Debug().Msgf("Requesting page %d: %s", response.pages+1, next)
+		path = next
+	}
+}
+
+// selectHandler returns the handler of the format forced by the options or,
+// when it is not set, the handler of the Content-Type. Responses without
+// Content-Type are detected from their content.
+func selectHandler(options exporterconfig.Options, contentType string) (handlers.Handler, error) {
+	if options.Format != exporterconfig.FormatAuto || options.Compression != exporterconfig.CompressionAuto {
+		return &octethandler.OctetHandler{}, nil
+	}
+	if contentType == "" {
+		return &octethandler.OctetHandler{}, nil
+	}
+	handler, ok := utils.GetHandler(contentType)
+	if !ok {
+		return nil, fmt.Errorf("content type not supported: %s, the format can be forced with the format field of the configuration", contentType)
+	}
+	return handler, nil
+}
+
+// resolveStream converts the data into CSV, streaming it when the handler
+// supports it. The route is reported only by the handlers detecting the
+// format from the content.
+func resolveStream(config exporterconfig.Config, handler handlers.Handler, data io.Reader) (io.Reader, string, error) {
+	if sniffingHandler, ok := handler.(handlers.SniffingHandler); ok {
+		return sniffingHandler.StreamRoute(config, data)
+	}
+	if streamHandler, ok := handler.(handlers.StreamHandler); ok {
+		reader, err := streamHandler.Stream(config, data)
+		return reader, "", err
+	}
+	buffered, err := io.ReadAll(data)
+	if err != nil {
+		return nil, "", err
+	}
+	resolved, err := handler.Resolve(config, buffered)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(resolved), "", nil
+}
+
+// fetchPage performs the request of a page with the retry policy of the
+// configuration: retryable failures (429, 5xx and network errors) are
+// attempted again with exponential backoff, up to MaxAttempts times, while
+// permanent failures (e.g., 404) fail immediately. A 401 or 403 refreshes the
+// credentials of the provider and is attempted again once. It calls retried
+// every time the request is attempted again.
+// The successful response is processed by handle while it is downloaded, its
+// failures are not retried since the body may have been partially consumed.
+func fetchPage(ctx context.Context, config exporterconfig.Config, provider *localendpoints.Provider, path string, retried func(), handle func(*http.Response) error) (*localstatus.Status, error) {
+	retry := config.Options.Retry
+	refreshed := false
+
+	for attempt := 1; ; attempt++ {
+		endpoint, err := provider.Get(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("could not resolve endpoint: %w", err)
+		}
+
+		opts := request.RequestOptions{
+			Endpoint: endpoint,
+			RequestInfo: request.RequestInfo{
+				Path:    path,
+				Verb:    &config.Spec.ExporterConfig.API.Verb,
+				Headers: config.Spec.ExporterConfig.API.Headers,
+				Payload: &config.Spec.ExporterConfig.API.Payload,
+			},
+		}
+
+		var handleErr error
+		res := localrequest.DoWithResponse(ctx, opts, func(respo *http.Response) error {
+			handleErr = handle(respo)
+			return handleErr
+		})
+		if handleErr != nil {
+			return nil, handleErr
+		}
+		if res.Code >= 200 && res.Code < 300 {
+			return res, nil
+		}
+
+		err = fmt.Errorf("received status code %d: %s", res.Code, res.Message)
+		if (res.Code == http.StatusUnauthorized || res.Code == http.StatusForbidden) && !refreshed {
+			// The credentials may have been rotated, resolve them again
+			log.Logger.Warn().Err(err).Msg("Authentication failed, refreshing credentials...")
+			provider.Invalidate()
+			refreshed = true
+			retried()
+			continue
+		}
+		if !isRetryable(res.Code) {
+			return nil, fmt.Errorf("permanent failure, not retrying: %w", err)
+		}
+		if attempt >= retry.MaxAttempts {
+			return nil, fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+		}
+
+		wait := backoff(retry, attempt, headerOf(res), time.Now())
+		log.Logger.Warn().Err(err).Msgf("Attempt %d of %d failed, retrying connection in %s...", attempt, retry.MaxAttempts, wait.Round(time.Millisecond))
+		if !sleep(ctx, wait) {
+			return nil, ctx.Err()
+		}
+		retried()
+	}
+}
+
+// pageError adds the page number to errors occurred after the first page
+func pageError(page int, err error) error {
+	if page == 0 {
+		return err
+	}
+	return fmt.Errorf("page %d: %w", page+1, err)
+}
+
+func headerOf(res *localstatus.Status) http.Header {
+	if res.Header == nil {
+		return http.Header{}
+	}
+	return *res.Header
+}
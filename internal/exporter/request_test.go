@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestMakeAPIRequestFormat(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write([]byte("cost\tid\n1.5\ta\n2\tb\n"))
+	gw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        []byte
+		format      string
+		compression string
+		route       string
+		err         string
+	}{
+		{
+			name:        "forced format and compression",
+			contentType: "application/x-download",
+			body:        compressed.Bytes(),
+			format:      exporterconfig.FormatTSV,
+			compression: exporterconfig.CompressionGzip,
+			route:       "gzip > tsv",
+		},
+		{
+			name:        "forced format, detected compression",
+			contentType: "application/json",
+			body:        compressed.Bytes(),
+			format:      exporterconfig.FormatTSV,
+			route:       "gzip > tsv",
+		},
+		{
+			name:        "tab separated values",
+			contentType: "text/tab-separated-values; charset=utf-8",
+			body:        []byte("cost\tid\n1.5\ta\n2\tb\n"),
+		},
+		{
+			name:        "newline delimited json",
+			contentType: "application/x-ndjson",
+			body:        []byte("{\"cost\": 1.5, \"id\": \"a\"}\n{\"cost\": 2, \"id\": \"b\"}\n"),
+		},
+		{
+			name:        "plain text",
+			contentType: "text/plain",
+			body:        []byte("cost,id\n1.5,a\n2,b\n"),
+			route:       "csv",
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/x-download",
+			body:        compressed.Bytes(),
+			err:         "content type not supported",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tc.contentType)
+				w.Write(tc.body)
+			}))
+			defer server.Close()
+
+			config := exporterconfig.Config{}
+			config.Spec.ExporterConfig.MetricType = "generic"
+			config.Spec.ExporterConfig.Generic = &finopsdatatypes.Generic{ValueColumnIndex: 0, MetricName: "cost"}
+			config.Spec.ExporterConfig.API.Path = "/export"
+			config.Options.Retry = exporterconfig.Retry{MaxAttempts: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+			config.Options.Pagination.MaxPages = exporterconfig.DefaultMaxPages
+			config.Options.Format = tc.format
+			config.Options.Compression = tc.compression
+
+			builder, err := newSnapshotBuilder(config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response, err := makeAPIRequest(context.Background(), config, newTestProvider(server.URL), builder, func() {})
+			if tc.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.err) {
+					t.Fatalf("expected error containing %q, got %v", tc.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if response.route != tc.route {
+				t.Errorf("expected route %q, got %q", tc.route, response.route)
+			}
+			if builder.records != 2 {
+				t.Errorf("expected 2 records, got %d", builder.records)
+			}
+		})
+	}
+}
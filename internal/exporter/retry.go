@@ -0,0 +1,55 @@
+package exporter
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+// isRetryable tells whether a request that ended with the given status code
+// can succeed if attempted again: rate limiting, timeouts and server errors,
+// which include the network errors reported by the request helper
+func isRetryable(code int) bool {
+	return code == http.StatusTooManyRequests ||
+		code == http.StatusRequestTimeout ||
+		code >= 500
+}
+
+// backoff returns the wait before the given retry (starting from 1): the
+// Retry-After header when present, otherwise an exponential backoff with
+// jitter. The wait is always capped to MaxBackoff.
+func backoff(retry exporterconfig.Retry, attempt int, header http.Header, now time.Time) time.Duration {
+	if header != nil {
+		if wait, ok := parseRetryAfter(header.Get("Retry-After"), now); ok {
+			return min(wait, retry.MaxBackoff)
+		}
+	}
+
+	wait := retry.InitialBackoff
+	for i := 1; i < attempt && wait < retry.MaxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, retry.MaxBackoff)
+	// Full jitter on the upper half, so that exporters do not retry in lockstep
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// parseRetryAfter parses the Retry-After header, expressed either in seconds
+// or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return max(time.Duration(seconds)*time.Second, 0), true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,144 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/endpoints"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	localendpoints "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/endpoints"
+)
+
+func TestBackoff(t *testing.T) {
+	retry := exporterconfig.Retry{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: 10 * time.Second}
+	now := time.Now()
+
+	for attempt, upper := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 6: 10 * time.Second} {
+		wait := backoff(retry, attempt, nil, now)
+		if wait < upper/2 || wait > upper {
+			t.Fatalf("attempt %d: wait %s not in [%s, %s]", attempt, wait, upper/2, upper)
+		}
+	}
+
+	header := http.Header{}
+	header.Set("Retry-After", "3")
+	if wait := backoff(retry, 1, header, now); wait != 3*time.Second {
+		t.Fatalf("expected Retry-After in seconds to be honored, got %s", wait)
+	}
+	header.Set("Retry-After", now.Add(time.Hour).UTC().Format(http.TimeFormat))
+	if wait := backoff(retry, 1, header, now); wait != retry.MaxBackoff {
+		t.Fatalf("expected Retry-After date to be capped to %s, got %s", retry.MaxBackoff, wait)
+	}
+}
+
+func newTestProvider(serverURL string) *localendpoints.Provider {
+	return localendpoints.NewProviderFunc(func(ctx context.Context) (endpoints.Endpoint, error) {
+		return endpoints.Endpoint{ServerURL: serverURL}, nil
+	})
+}
+
+func TestMakeAPIRequestRetries(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Retry = exporterconfig.Retry{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	tests := []struct {
+		name            string
+		codes           []int
+		expectedError   bool
+		expectedRetries int32
+	}{
+		{name: "transient failures", codes: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, expectedRetries: 2},
+		{name: "permanent failure", codes: []int{http.StatusNotFound}, expectedError: true, expectedRetries: 0},
+		{name: "authentication failure", codes: []int{http.StatusForbidden}, expectedError: true, expectedRetries: 1},
+		{name: "attempts exhausted", codes: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK}, expectedError: true, expectedRetries: 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				code := tc.codes[min(int(atomic.AddInt32(&calls, 1))-1, len(tc.codes)-1)]
+				if code != http.StatusOK {
+					w.Header().Set("Retry-After", "0")
+					http.Error(w, http.StatusText(code), code)
+					return
+				}
+				w.Header().Set("Content-Type", "text/csv")
+				w.Write([]byte("ResourceId,BilledCost\nvm-1,1.5"))
+			}))
+			defer server.Close()
+
+			builder, err := newSnapshotBuilder(config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var retries int32
+			_, err = makeAPIRequest(context.Background(), config, newTestProvider(server.URL), builder, func() {
+				retries++
+			})
+			if tc.expectedError != (err != nil) {
+				t.Fatalf("unexpected error result: %v", err)
+			}
+			if retries != tc.expectedRetries {
+				t.Fatalf("expected %d retries, got %d", tc.expectedRetries, retries)
+			}
+			if !tc.expectedError && builder.snapshot.Len() != 1 {
+				t.Fatalf("expected 1 series, got %d", builder.snapshot.Len())
+			}
+		})
+	}
+}
+
+func TestMakeAPIRequestRefreshesCredentials(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Retry = exporterconfig.Retry{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer rotated" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv")
+		w.Write([]byte("ResourceId,BilledCost\nvm-1,1.5"))
+	}))
+	defer server.Close()
+
+	// The Secret is rotated after the first resolution
+	var resolutions int32
+	provider := localendpoints.NewProviderFunc(func(ctx context.Context) (endpoints.Endpoint, error) {
+		token := "expired"
+		if atomic.AddInt32(&resolutions, 1) > 1 {
+			token = "rotated"
+		}
+		return endpoints.Endpoint{ServerURL: server.URL, Token: token}, nil
+	})
+	if _, err := provider.Get(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := makeAPIRequest(context.Background(), config, provider, builder, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolutions != 2 {
+		t.Fatalf("expected credentials to be resolved again once, got %d resolutions", resolutions)
+	}
+
+	// The refreshed endpoint is cached for the following requests
+	if _, err := makeAPIRequest(context.Background(), config, provider, builder, func() {}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resolutions != 2 {
+		t.Fatalf("expected cached credentials, got %d resolutions", resolutions)
+	}
+}
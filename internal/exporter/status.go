@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"fmt"
+	"time"
+)
+
+// Status describes the state of the polling loop of an exporter.
+type Status struct {
+	File            string     `json:"file"`
+	Name            string     `json:"name,omitempty"`
+	Namespace       string     `json:"namespace,omitempty"`
+	PollingInterval string     `json:"pollingInterval,omitempty"`
+	LastPoll        *time.Time `json:"lastPoll,omitempty"`
+	LastSuccess     *time.Time `json:"lastSuccess,omitempty"`
+	LastError       string     `json:"lastError,omitempty"`
+	ContentType     string     `json:"contentType,omitempty"`
+	Handler         string     `json:"handler,omitempty"`
+	Route           string     `json:"route,omitempty"`
+	Records         int        `json:"records"`
+	// RenamedColumns maps the columns to their labels, when their name is
+	// not a valid label name or is already taken
+	RenamedColumns map[string]string `json:"renamedColumns,omitempty"`
+	Series         int               `json:"series"`
+	Generation     uint64            `json:"generation"`
+
+	pollingInterval time.Duration
+	failureWait     time.Duration
+}
+
+// Status returns a copy of the current status of the exporter.
+func (e *Exporter) Status() Status {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	status := e.status
+	status.File = e.file
+	status.Generation = e.collector.Current().Generation()
+	status.Series = e.collector.Current().Len()
+	return status
+}
+
+// Ready returns an error unless the exporter completed at least one poll and
+// its data is not older than maxIntervals polling intervals.
+func (e *Exporter) Ready(now time.Time, maxIntervals int) error {
+	status := e.Status()
+	if status.LastSuccess == nil {
+		return fmt.Errorf("%s: no successful poll yet", e.file)
+	}
+	// Failed polls are retried after failureWait, which is the maximum backoff
+	// when the polling interval is not set and never exceeds it otherwise
+	interval := max(status.pollingInterval, status.failureWait)
+	if age := now.Sub(*status.LastSuccess); age > time.Duration(maxIntervals)*interval {
+		return fmt.Errorf("%s: data is stale, last successful poll %s ago", e.file, age.Round(time.Second))
+	}
+	return nil
+}
+
+func (e *Exporter) updateStatus(update func(status *Status)) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	update(&e.status)
+}
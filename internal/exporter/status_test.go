@@ -0,0 +1,50 @@
+package exporter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/collector"
+)
+
+func TestReady(t *testing.T) {
+	now := time.Now()
+	e := New("config.yaml", NewMetrics(prometheus.NewRegistry()), collector.NewHelps())
+
+	if err := e.Ready(now, 3); err == nil {
+		t.Fatal("expected not ready before the first poll")
+	}
+
+	e.updateStatus(func(status *Status) {
+		status.pollingInterval = time.Minute
+		lastSuccess := now.Add(-2 * time.Minute)
+		status.LastSuccess = &lastSuccess
+	})
+	if err := e.Ready(now, 3); err != nil {
+		t.Fatalf("expected ready, got %v", err)
+	}
+
+	e.updateStatus(func(status *Status) {
+		lastSuccess := now.Add(-4 * time.Minute)
+		status.LastSuccess = &lastSuccess
+	})
+	if err := e.Ready(now, 3); err == nil {
+		t.Fatal("expected not ready with stale data")
+	}
+}
+
+func TestStatusOmitsPollTimes(t *testing.T) {
+	e := New("config.yaml", NewMetrics(prometheus.NewRegistry()), collector.NewHelps())
+
+	encoded, err := json.Marshal(e.Status())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(encoded), "lastPoll") || strings.Contains(string(encoded), "lastSuccess") {
+		t.Errorf("expected no poll times before the first poll, got %s", encoded)
+	}
+}
@@ -0,0 +1,109 @@
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/names"
+)
+
+// tag is a key value pair of a Tags column
+type tag struct {
+	key   string
+	value string
+}
+
+// parseTags parses the value of a Tags column, which is written as a JSON
+// object, e.g., {"team":"x"} in FOCUS, a JSON array of key value objects,
+// e.g., [{"key":"team","value":"x"}], or a list of key=value or key:value
+// pairs separated by semicolons or commas, e.g., team=x;env=prod. The tags
+// are sorted by key.
+func parseTags(value string) []tag {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var tags []tag
+	var object map[string]interface{}
+	var array []struct {
+		Key   string      `json:"key"`
+		Value interface{} `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(value), &object); err == nil {
+		for k, v := range object {
+			tags = append(tags, tag{key: k, value: tagValue(v)})
+		}
+	} else if err := json.Unmarshal([]byte(value), &array); err == nil {
+		for _, pair := range array {
+			tags = append(tags, tag{key: pair.Key, value: tagValue(pair.Value)})
+		}
+	} else {
+		value = strings.Trim(value, "{}[]")
+		separator := ";"
+		if !strings.Contains(value, ";") {
+			separator = ","
+		}
+		for _, pair := range strings.Split(value, separator) {
+			k, v, found := strings.Cut(pair, "=")
+			if !found {
+				k, v, _ = strings.Cut(pair, ":")
+			}
+			tags = append(tags, tag{key: strings.Trim(strings.TrimSpace(k), "\""), value: strings.Trim(strings.TrimSpace(v), "\"")})
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i].key < tags[j].key })
+	return tags
+}
+
+func tagValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(encoded)
+}
+
+// addTags adds a label for each tag of the Tags column value allowed by the
+// options, e.g., tag_team. The labels of the columns are not replaced. The
+// distinct tags that become labels are capped by MaxKeys for the whole
+// snapshot, so that the number of label names stays bounded.
+func (b *snapshotBuilder) addTags(labels prometheus.Labels, value string) {
+	options := b.config.Options.Tags
+	for _, tag := range parseTags(value) {
+		if tag.key == "" || tag.value == "" {
+			continue
+		}
+		if len(options.Keys) > 0 && !containsFold(options.Keys, tag.key) {
+			continue
+		}
+		name, ok := b.tagLabels[tag.key]
+		if !ok {
+			if len(b.tagLabels) >= b.maxTagKeys {
+				if !b.tagsCapped {
+					log.Logger.Warn().Msgf("more than %d distinct tags, ignoring tag %s and the following ones", b.maxTagKeys, tag.key)
+					b.tagsCapped = true
+				}
+				continue
+			}
+			name = names.Sanitize(b.tagPrefix + names.Snake(tag.key))
+			b.tagLabels[tag.key] = name
+		}
+		if _, ok := labels[name]; ok {
+			continue
+		}
+		labels[name] = tag.value
+	}
+}
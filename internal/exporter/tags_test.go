@@ -0,0 +1,75 @@
+package exporter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestParseTags(t *testing.T) {
+	tests := map[string][]tag{
+		`{"team":"x","env":"prod"}`:                   {{"env", "prod"}, {"team", "x"}},
+		`{"team"="x","env"="prod"}`:                   {{"env", "prod"}, {"team", "x"}},
+		`[{"key":"team","value":"x"}]`:                {{"team", "x"}},
+		`team=x;env=prod`:                             {{"env", "prod"}, {"team", "x"}},
+		`team:x,cost-center:42`:                       {{"cost-center", "42"}, {"team", "x"}},
+		`{"count":3,"owner":null,"nested":{"a":"b"}}`: {{"count", "3"}, {"nested", `{"a":"b"}`}, {"owner", ""}},
+		``: nil,
+	}
+	for value, expected := range tests {
+		if got := parseTags(value); !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected %v, got %v", value, expected, got)
+		}
+	}
+}
+
+func TestReadRecordsTags(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.MetricType = "cost"
+	config.Options.Tags = exporterconfig.Tags{Explode: true, MaxKeys: 2}
+
+	builder, err := newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data := "ResourceId,BilledCost,Tags\n" +
+		"vm-1,1.5,\"{\"\"team\"\":\"\"x\"\",\"\"CostCenter\"\":\"\"42\"\"}\"\n" +
+		"vm-2,2,\"{\"\"team\"\":\"\"y\"\",\"\"env\"\":\"\"prod\"\"}\"\n"
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c := newTestCollector(t, builder)
+	expected := `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",exporter_config_name="",exporter_config_namespace="",tag_cost_center="42",tag_team="x"} 1.5
+billed_cost{ResourceId="vm-2",exporter_config_name="",exporter_config_namespace="",tag_team="y"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+
+	config.Options.Tags = exporterconfig.Tags{Explode: true, Keys: []string{"ENV"}, KeepColumn: true}
+	builder, err = newSnapshotBuilder(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := readRecords(strings.NewReader(data), builder); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	c = newTestCollector(t, builder)
+	expected = `
+# HELP billed_cost 
+# TYPE billed_cost gauge
+billed_cost{ResourceId="vm-1",Tags="team:x;CostCenter:42",exporter_config_name="",exporter_config_namespace=""} 1.5
+billed_cost{ResourceId="vm-2",Tags="team:y;env:prod",exporter_config_name="",exporter_config_namespace="",tag_env="prod"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
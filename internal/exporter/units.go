@@ -0,0 +1,33 @@
+package exporter
+
+import "strings"
+
+// unit is a Prometheus base unit, the values are multiplied by factor to be
+// converted into it
+type unit struct {
+	name   string
+	factor float64
+}
+
+// units maps the units of Azure Monitor, lowercase, to the base units of
+// Prometheus. Counts have no unit.
+var units = map[string]unit{
+	"count":          {"", 1},
+	"percent":        {"ratio", 0.01},
+	"bytes":          {"bytes", 1},
+	"bytespersecond": {"bytes_per_second", 1},
+	"bitspersecond":  {"bytes_per_second", 1.0 / 8},
+	"seconds":        {"seconds", 1},
+	"milliseconds":   {"seconds", 1e-3},
+	"byteseconds":    {"byte_seconds", 1},
+	"cores":          {"cores", 1},
+	"millicores":     {"cores", 1e-3},
+	"nanocores":      {"cores", 1e-9},
+}
+
+// normalizeUnit returns the base unit of the unit of Azure Monitor, e.g.,
+// ratio for Percent
+func normalizeUnit(name string) (unit, bool) {
+	u, ok := units[strings.ToLower(strings.TrimSpace(name))]
+	return u, ok
+}
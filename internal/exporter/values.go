@@ -0,0 +1,134 @@
+package exporter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// groupingReplacer removes the characters used to group the digits of the
+// integer part, e.g., 1 000 000 or 1'000'000
+var groupingReplacer = strings.NewReplacer(" ", "", "\u00a0", "", "\u202f", "", "'", "", "\u2019", "")
+
+// parseValue parses the value of a metric. Besides the numbers understood by
+// strconv.ParseFloat, it accepts:
+//   - booleans, true is 1 and false is 0
+//   - currency symbols and ISO 4217 codes, e.g., $1,234.50 or 12,50 EUR
+//   - negative amounts in parentheses, e.g., (12.50)
+//   - percentages, converted into ratios, e.g., 50% is 0.5
+//   - grouped digits and decimal commas, e.g., 1.234,50
+//
+// The decimal separator, "." or ",", is detected from the value when it is
+// empty.
+func parseValue(value string, decimalSeparator string) (float64, error) {
+	s := strings.TrimSpace(value)
+	if decimalSeparator != "," {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f, nil
+		}
+	}
+	switch strings.ToLower(s) {
+	case "true":
+		return 1, nil
+	case "false":
+		return 0, nil
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	s = strings.ReplaceAll(s, "\u2212", "-")
+	ratio := false
+	if strings.HasSuffix(s, "%") {
+		ratio = true
+		s = strings.TrimSpace(strings.TrimSuffix(s, "%"))
+	}
+	s = trimCurrency(s)
+	s = groupingReplacer.Replace(s)
+
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	if s == "" || strings.ContainsAny(s, "+-") {
+		return 0, fmt.Errorf("invalid number: %q", value)
+	}
+
+	s = normalizeSeparators(s, decimalSeparator)
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number: %q", value)
+	}
+	if negative {
+		f = -f
+	}
+	if ratio {
+		f /= 100
+	}
+	return f, nil
+}
+
+// trimCurrency removes the currency symbols and a leading or trailing ISO
+// 4217 code, e.g., USD, together with the spaces around them
+func trimCurrency(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Sc, r) {
+			return -1
+		}
+		return r
+	}, s)
+	s = strings.TrimSpace(s)
+	if len(s) > 3 && isCurrencyCode(s[:3]) {
+		s = strings.TrimSpace(s[3:])
+	} else if len(s) > 3 && isCurrencyCode(s[len(s)-3:]) {
+		s = strings.TrimSpace(s[:len(s)-3])
+	}
+	return s
+}
+
+func isCurrencyCode(s string) bool {
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeSeparators removes the grouping separators and replaces the
+// decimal separator with a dot. When the decimal separator is not given, the
+// last separator of a value with both dots and commas is the decimal one, a
+// separator repeated more than once groups the digits and a single comma
+// followed by exactly three digits groups the digits too, unless the integer
+// part is zero, e.g., 1,234 is 1234 while 0,125 is 0.125.
+func normalizeSeparators(s string, decimalSeparator string) string {
+	switch decimalSeparator {
+	case ".":
+		return strings.ReplaceAll(s, ",", "")
+	case ",":
+		return strings.ReplaceAll(strings.ReplaceAll(s, ".", ""), ",", ".")
+	}
+
+	dot, comma := strings.LastIndex(s, "."), strings.LastIndex(s, ",")
+	switch {
+	case dot >= 0 && comma >= 0:
+		if dot > comma {
+			return normalizeSeparators(s, ".")
+		}
+		return normalizeSeparators(s, ",")
+	case comma >= 0:
+		integer := s[:comma]
+		if strings.Count(s, ",") > 1 || (len(s)-comma-1 == 3 && integer != "0" && integer != "") {
+			return strings.ReplaceAll(s, ",", "")
+		}
+		return strings.Replace(s, ",", ".", 1)
+	case strings.Count(s, ".") > 1:
+		return strings.ReplaceAll(s, ".", "")
+	}
+	return s
+}
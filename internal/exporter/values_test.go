@@ -0,0 +1,57 @@
+package exporter
+
+import "testing"
+
+func TestParseValue(t *testing.T) {
+	tests := []struct {
+		value            string
+		decimalSeparator string
+		expected         float64
+		wantErr          bool
+	}{
+		{value: "1.5", expected: 1.5},
+		{value: " 42 ", expected: 42},
+		{value: "-0.25", expected: -0.25},
+		{value: "1e3", expected: 1000},
+		{value: "0.1234567890123456789", expected: 0.1234567890123456789},
+		{value: "true", expected: 1},
+		{value: "FALSE", expected: 0},
+		{value: "$1,234.50", expected: 1234.50},
+		{value: "-$12.50", expected: -12.50},
+		{value: "($12.50)", expected: -12.50},
+		{value: "€ 1.234,50", expected: 1234.50},
+		{value: "12,50 EUR", expected: 12.50},
+		{value: "USD 99.99", expected: 99.99},
+		{value: "1 234,5", expected: 1234.5},
+		{value: "1'234'567", expected: 1234567},
+		{value: "1,234", expected: 1234},
+		{value: "0,125", expected: 0.125},
+		{value: "12,5", expected: 12.5},
+		{value: "1.234.567", expected: 1234567},
+		{value: "50%", expected: 0.5},
+		{value: "12,5 %", expected: 0.125},
+		{value: "1.234", decimalSeparator: ",", expected: 1234},
+		{value: "1,234", decimalSeparator: ",", expected: 1.234},
+		{value: "1,234", decimalSeparator: ".", expected: 1234},
+		{value: "", wantErr: true},
+		{value: "not-a-number", wantErr: true},
+		{value: "1-2", wantErr: true},
+		{value: "$", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseValue(tt.value, tt.decimalSeparator)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %v", tt.value, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("%q: expected %v, got %v", tt.value, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package exporter
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/rs/zerolog"
+)
+
+// watchConfig notifies the exporter whenever the content of its configuration
+// file changes. The parent directory is watched instead of the file itself, so
+// that the atomic symlink swaps of mounted ConfigMaps (..data) are detected.
+func (e *Exporter) watchConfig(ctx context.Context, logger zerolog.Logger) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warn().Err(err).Msg("could not create configuration watcher, changes will be applied on restart")
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add(filepath.Dir(e.file)); err != nil {
+		logger.Warn().Err(err).Msg("could not watch configuration directory, changes will be applied on restart")
+		return
+	}
+
+	lastHash, _ := hashFile(e.file)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			logger.Warn().Err(err).Msg("error while watching configuration")
+		case _, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			// Any event in the directory can be a swap of the file, compare the content
+			hash, err := hashFile(e.file)
+			if err != nil || hash == lastHash {
+				continue
+			}
+			lastHash = hash
+			logger.Info().Msg("Configuration changed, reloading...")
+			e.requestReload()
+		}
+	}
+}
+
+// requestReload interrupts the current iteration of the polling loop, which
+// parses the configuration again before the next poll
+func (e *Exporter) requestReload() {
+	select {
+	case e.reload <- struct{}{}:
+	default:
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.cancelIteration != nil {
+		e.cancelIteration()
+	}
+}
+
+func hashFile(file string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
@@ -0,0 +1,72 @@
+package exporter
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/collector"
+)
+
+func TestWatchConfigSymlinkSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeData := func(name, content string) {
+		t.Helper()
+		dataDir := filepath.Join(dir, name)
+		if err := os.Mkdir(dataDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dataDir, "config.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Same layout and update sequence used by the kubelet for ConfigMaps
+	writeData("..v1", "pollingInterval: 1h")
+	if err := os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "config.yaml"), filepath.Join(dir, "config.yaml")); err != nil {
+		t.Fatal(err)
+	}
+
+	e := New(filepath.Join(dir, "config.yaml"), NewMetrics(prometheus.NewRegistry()), collector.NewHelps())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	iterationCtx, cancelIteration := context.WithCancel(ctx)
+	e.cancelIteration = cancelIteration
+	go e.watchConfig(ctx, log.Logger)
+	// Give the watcher time to register
+	time.Sleep(100 * time.Millisecond)
+
+	// Touching the directory without changing the content does not reload
+	if err := os.WriteFile(filepath.Join(dir, "unrelated"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.reload:
+		t.Fatal("unexpected reload without configuration changes")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	writeData("..v2", "pollingInterval: 1m")
+	if err := os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-e.reload:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected reload after configuration change")
+	}
+	if iterationCtx.Err() == nil {
+		t.Fatal("expected the current iteration to be interrupted")
+	}
+}
@@ -1,9 +1,17 @@
 package csv
 
-import finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+import (
+	"io"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
 
 type CsvHandler struct{}
 
-func (r *CsvHandler) Resolve(config finopsdatatypes.ExporterScraperConfig, data []byte) ([]byte, error) {
+func (r *CsvHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func (r *CsvHandler) Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error) {
 	return data, nil
 }
@@ -1,7 +1,27 @@
 package handlers
 
-import finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+import (
+	"io"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
 
 type Handler interface {
-	Resolve(config finopsdatatypes.ExporterScraperConfig, data []byte) ([]byte, error)
+	Resolve(config exporterconfig.Config, data []byte) ([]byte, error)
+}
+
+// StreamHandler is implemented by the handlers that can convert the data
+// while it is read, without buffering the whole response in memory. The
+// returned reader produces CSV.
+type StreamHandler interface {
+	Handler
+	Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error)
+}
+
+// SniffingHandler is implemented by the handlers that detect the format from
+// the content of the data. The returned route describes the decompressors and
+// the parser applied, e.g., "gzip > csv".
+type SniffingHandler interface {
+	StreamHandler
+	StreamRoute(config exporterconfig.Config, data io.Reader) (io.Reader, string, error)
 }
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"sort"
 	"strconv"
@@ -12,7 +14,10 @@ import (
 	"time"
 
 	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
-	configmetrics "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/jsonpath"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/names"
+	"github.com/prometheus/common/model"
 	"github.com/rs/zerolog/log"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -52,8 +57,8 @@ func GetOutputStrFOCUS(configList finopsdatatypes.FocusConfigList) string {
 	return outputStr
 }
 
-func TryParseResponseAsMetricsJSON(jsonData []byte, config finopsdatatypes.ExporterScraperConfig) ([]byte, error) {
-	data := configmetrics.Metrics{}
+func TryParseResponseAsMetricsJSON(jsonData []byte, config exporterconfig.Config) ([]byte, error) {
+	data := exporterconfig.Metrics{}
 	err := json.Unmarshal(jsonData, &data)
 	if err != nil {
 		log.Logger.Error().Err(err).Msg("error decoding metrics response")
@@ -67,12 +72,25 @@ func TryParseResponseAsMetricsJSON(jsonData []byte, config finopsdatatypes.Expor
 	return []byte(GetOutputStrMetrics(data, config)), nil
 }
 
-func TryParseUnknownJSONToCSV(jsonData []byte, config finopsdatatypes.ExporterScraperConfig) ([]byte, error) {
+func TryParseUnknownJSONToCSV(jsonData []byte, config exporterconfig.Config) ([]byte, error) {
+	generic := config.Options.Generic
+	if generic.RecordsPath != "" {
+		arrayRecords, err := selectJSONRecords(jsonData, generic.RecordsPath)
+		if err != nil {
+			return nil, err
+		}
+		if len(arrayRecords) == 0 {
+			log.Logger.Warn().Msgf("JSON contains no records at %s", generic.RecordsPath)
+			return []byte(""), nil
+		}
+		return JSONRecordsToCSV(arrayRecords, generic)
+	}
+
 	var arrayRecords []map[string]interface{}
-	err := json.Unmarshal(jsonData, &arrayRecords)
+	err := DecodeJSON(jsonData, &arrayRecords)
 	if err != nil {
 		var wrapper map[string]interface{}
-		err2 := json.Unmarshal(jsonData, &wrapper)
+		err2 := DecodeJSON(jsonData, &wrapper)
 		if err2 != nil {
 			log.Logger.Error().Err(err2).Msg("error decoding input JSON")
 			if e, ok := err2.(*json.SyntaxError); ok {
@@ -82,9 +100,17 @@ func TryParseUnknownJSONToCSV(jsonData []byte, config finopsdatatypes.ExporterSc
 			return nil, err2
 		}
 
+		// The fields are visited in order, so that the same array is chosen
+		// at every poll
+		keys := make([]string, 0, len(wrapper))
+		for k := range wrapper {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
 		found := false
-		for _, v := range wrapper {
-			arr, ok := v.([]interface{})
+		for _, k := range keys {
+			arr, ok := wrapper[k].([]interface{})
 			if !ok {
 				continue
 			}
@@ -112,8 +138,70 @@ func TryParseUnknownJSONToCSV(jsonData []byte, config finopsdatatypes.ExporterSc
 		return []byte(""), nil
 	}
 
+	return JSONRecordsToCSV(arrayRecords, generic)
+}
+
+// DecodeJSON decodes the JSON data keeping the numbers as json.Number, so
+// that they are written exactly as in the response, without the precision
+// loss or the exponent of float64
+func DecodeJSON(jsonData []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid data after top-level value at byte offset %d", decoder.InputOffset())
+	}
+	return nil
+}
+
+// selectJSONRecords returns the objects selected by the JSONPath expression:
+// the selected arrays are replaced by their elements
+func selectJSONRecords(jsonData []byte, recordsPath string) ([]map[string]interface{}, error) {
+	expression, err := jsonpath.Compile(recordsPath)
+	if err != nil {
+		return nil, err
+	}
+	var document interface{}
+	if err := DecodeJSON(jsonData, &document); err != nil {
+		return nil, fmt.Errorf("error decoding input JSON: %w", err)
+	}
+	values, err := expression.Find(document)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]interface{}{}
+	for _, value := range values {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			if record, ok := item.(map[string]interface{}); ok {
+				records = append(records, record)
+			}
+		}
+	}
+	return records, nil
+}
+
+// JSONRecordsToCSV writes the records as CSV, with the union of their keys,
+// sorted, as header. The columns are computed from each record before the
+// nested objects and arrays are flattened.
+func JSONRecordsToCSV(records []map[string]interface{}, generic exporterconfig.Generic) ([]byte, error) {
+	if err := addJSONColumns(records, generic.Columns); err != nil {
+		return nil, err
+	}
+	flattened := make([]map[string]interface{}, 0, len(records))
+	for _, record := range records {
+		flattened = append(flattened, flattenJSONRecord(record, generic.Flatten)...)
+	}
+	records = flattened
+
 	keySet := make(map[string]struct{})
-	for _, rec := range arrayRecords {
+	for _, rec := range records {
 		for k := range rec {
 			keySet[k] = struct{}{}
 		}
@@ -133,7 +221,7 @@ func TryParseUnknownJSONToCSV(jsonData []byte, config finopsdatatypes.ExporterSc
 		return nil, err
 	}
 
-	for _, rec := range arrayRecords {
+	for _, rec := range records {
 		row := make([]string, len(header))
 		for i, key := range header {
 			if val, ok := rec[key]; ok && val != nil {
@@ -155,7 +243,7 @@ func TryParseUnknownJSONToCSV(jsonData []byte, config finopsdatatypes.ExporterSc
 	return []byte(b.String()), nil
 }
 
-func GetOutputStrMetrics(configList configmetrics.Metrics, config finopsdatatypes.ExporterScraperConfig) string {
+func GetOutputStrMetrics(configList exporterconfig.Metrics, config exporterconfig.Config) string {
 	stringCSV := "ResourceId,metricName,timestamp,average,unit\n"
 	for _, value := range configList.Value {
 		for _, timeseries := range value.Timeseries {
@@ -205,6 +293,103 @@ func GetStringValue(value any) string {
 	return ""
 }
 
+// addJSONColumns sets the columns in each record with the values selected
+// by their expressions, relative to the record. A column selecting multiple
+// values holds all of them.
+func addJSONColumns(records []map[string]interface{}, columns []exporterconfig.Column) error {
+	for _, column := range columns {
+		expression, err := jsonpath.Compile(column.Path)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			values, err := expression.Find(record)
+			if err != nil {
+				return err
+			}
+			switch len(values) {
+			case 0:
+				delete(record, column.Name)
+			case 1:
+				record[column.Name] = values[0]
+			default:
+				record[column.Name] = values
+			}
+		}
+	}
+	return nil
+}
+
+// flattenJSONRecord returns the rows of the record, with the keys of nested
+// objects joined by the separator. Arrays are encoded as JSON, indexed as
+// columns or exploded into a row per element, according to the configuration.
+func flattenJSONRecord(record map[string]interface{}, flatten exporterconfig.Flatten) []map[string]interface{} {
+	if flatten.Separator == "" {
+		flatten.Separator = exporterconfig.DefaultFlattenSeparator
+	}
+	rows := []map[string]interface{}{{}}
+	flattenJSONValue(&rows, "", record, flatten)
+	return rows
+}
+
+func flattenJSONValue(rows *[]map[string]interface{}, key string, value interface{}, flatten exporterconfig.Flatten) {
+	join := func(child string) string {
+		if key == "" {
+			return child
+		}
+		return key + flatten.Separator + child
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		// Sorted, so that exploded rows are always in the same order
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			flattenJSONValue(rows, join(k), v[k], flatten)
+		}
+	case []interface{}:
+		switch flatten.Arrays {
+		case exporterconfig.ArraysIndex:
+			for i, item := range v {
+				flattenJSONValue(rows, join(strconv.Itoa(i)), item, flatten)
+			}
+		case exporterconfig.ArraysExplode:
+			if len(v) == 0 {
+				return
+			}
+			exploded := make([]map[string]interface{}, 0, len(*rows)*len(v))
+			for _, item := range v {
+				branch := make([]map[string]interface{}, len(*rows))
+				for i, row := range *rows {
+					branch[i] = make(map[string]interface{}, len(row))
+					for k, rv := range row {
+						branch[i][k] = rv
+					}
+				}
+				flattenJSONValue(&branch, key, item, flatten)
+				exploded = append(exploded, branch...)
+			}
+			*rows = exploded
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return
+			}
+			for _, row := range *rows {
+				row[key] = string(encoded)
+			}
+		}
+	default:
+		for _, row := range *rows {
+			row[key] = v
+		}
+	}
+}
+
 // Prometheus parsing
 
 type PrometheusResponse struct {
@@ -225,7 +410,7 @@ type PrometheusResult struct {
 
 func TryParseUnknownJSONToPrometheusCSV(
 	jsonData []byte,
-	config finopsdatatypes.ExporterScraperConfig,
+	config exporterconfig.Config,
 ) ([]byte, error) {
 
 	var resp PrometheusResponse
@@ -256,7 +441,7 @@ func TryParseUnknownJSONToPrometheusCSV(
 
 func PrometheusToCSV(
 	response PrometheusResponse,
-	config finopsdatatypes.ExporterScraperConfig,
+	config exporterconfig.Config,
 ) ([]byte, error) {
 
 	// Collect unique labels
@@ -277,31 +462,19 @@ func PrometheusToCSV(
 	}
 	sort.Strings(labels)
 
-	// Sanitize headers
-	labelMap := make(map[string]string)
-	used := map[string]int{}
-
+	// Sanitize headers, the value and timestamp columns keep their names and
+	// the duplicated labels are suffixed in alphabetical order
+	header := make([]string, 0, len(labels)+2)
 	for _, l := range labels {
-		s := sanitizePrometheusLabel(l)
-		if cnt, ok := used[s]; ok {
-			cnt++
-			used[s] = cnt
-			s = fmt.Sprintf("%s_%d", s, cnt)
-		} else {
-			used[s] = 1
-		}
-		labelMap[l] = s
+		header = append(header, sanitizePrometheusLabel(l))
 	}
+	names.Dedupe(header, nil, "value", "timestamp")
+	header = append(header, "value", "timestamp")
 
 	var buf bytes.Buffer
 	writer := csv.NewWriter(&buf)
 
 	// Header
-	header := make([]string, 0, len(labels)+2)
-	for _, l := range labels {
-		header = append(header, labelMap[l])
-	}
-	header = append(header, "value", "timestamp")
 	if err := writer.Write(header); err != nil {
 		return nil, err
 	}
@@ -375,36 +548,22 @@ func formatPrometheusValue(val interface{}) string {
 	}
 }
 
+// sanitizePrometheusLabel returns the column of a label of the Prometheus
+// response, the metric name is the metric_name column. The leading and
+// trailing underscores are removed and a leading digit is prefixed with
+// label_, unlike names.Sanitize, so that the labels of the existing series
+// keep their names.
 func sanitizePrometheusLabel(label string) string {
-	if label == "__name__" {
+	if label == model.MetricNameLabel {
 		return "metric_name"
 	}
 
 	label = strings.Trim(label, "_")
-
-	var b strings.Builder
-	for _, r := range label {
-		switch {
-		case r == '_',
-			r >= 'a' && r <= 'z',
-			r >= 'A' && r <= 'Z',
-			r >= '0' && r <= '9':
-			b.WriteRune(r)
-		case r == '-':
-			b.WriteRune('_')
-		default:
-			b.WriteRune('_')
-		}
-	}
-
-	s := b.String()
-	if s == "" {
+	if label == "" {
 		return "label"
 	}
-
-	if s[0] >= '0' && s[0] <= '9' {
-		s = "label_" + s
+	if label[0] >= '0' && label[0] <= '9' {
+		label = "label_" + label
 	}
-
-	return s
+	return names.Sanitize(label)
 }
@@ -7,7 +7,7 @@ import (
 	"testing"
 	"time"
 
-	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
 	"github.com/rs/zerolog/log"
 )
 
@@ -25,7 +25,7 @@ func TestTryParseUnknownJSONToCSV(t *testing.T) {
               { "test": "name2",  "value": 1.40 }
             ]`),
 			expected: []string{
-				"test,value\nname,0.34\nname2,1.4\n",
+				"test,value\nname,0.34\nname2,1.40\n",
 			},
 		},
 		{
@@ -36,7 +36,7 @@ func TestTryParseUnknownJSONToCSV(t *testing.T) {
               { "test": "name2",  "value": 1.40 }
             ]`),
 			expected: []string{
-				"additional,test,value\ncolumn,name,0.34\n,name2,1.4\n",
+				"additional,test,value\ncolumn,name,0.34\n,name2,1.40\n",
 			},
 		},
 		{
@@ -66,7 +66,7 @@ func TestTryParseUnknownJSONToCSV(t *testing.T) {
               ]
             }`),
 			expected: []string{
-				"test,value\nname,0.34\nname2,1.4\n",
+				"test,value\nname,0.34\nname2,1.40\n",
 			},
 		},
 		{
@@ -80,7 +80,7 @@ func TestTryParseUnknownJSONToCSV(t *testing.T) {
 			  "toplevellabel": "value"
             }`),
 			expected: []string{
-				"test,value\nname,0.34\nname2,1.4\n",
+				"test,value\nname,0.34\nname2,1.40\n",
 			},
 		},
 	}
@@ -113,14 +113,14 @@ func TestTryParseUnknownJSONToCSV(t *testing.T) {
               { "test": "name2",  "value": 1.40 }
             ]`),
 			expected: []string{
-				"test,value,additional\ncolumn,name,0.34\n,name2,1.4\n",
+				"test,value,additional\ncolumn,name,0.34\n,name2,1.40\n",
 			},
 			shouldError: false,
 			shouldMatch: false,
 		},
 	}
 
-	config := finopsdatatypes.ExporterScraperConfig{}
+	config := exporterconfig.Config{}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
@@ -302,7 +302,7 @@ func TestTryParseUnknownJSONToPrometheusCSV(t *testing.T) {
 		},
 	}
 
-	config := finopsdatatypes.ExporterScraperConfig{}
+	config := exporterconfig.Config{}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -363,3 +363,124 @@ func TestTryParseUnknownJSONToPrometheusCSV(t *testing.T) {
 		})
 	}
 }
+
+func TestTryParseUnknownJSONToCSVRecordsPath(t *testing.T) {
+	input := []byte(`{
+		"alerts": [{ "id": "x" }],
+		"data": {
+			"items": [
+				{ "id": "a", "cost": 1.5, "properties": { "location": "eu", "tags": ["x", "y"] } },
+				{ "id": "b", "cost": 2, "properties": { "location": "us" } }
+			]
+		}
+	}`)
+
+	tests := []struct {
+		name     string
+		generic  exporterconfig.Generic
+		expected string
+	}{
+		{
+			name:     "first array in order",
+			expected: "id\nx\n",
+		},
+		{
+			name:     "records path",
+			generic:  exporterconfig.Generic{RecordsPath: "$.data.items"},
+			expected: "cost,id,properties.location,properties.tags\n1.5,a,eu,\"[\"\"x\"\",\"\"y\"\"]\"\n2,b,us,\n",
+		},
+		{
+			name:     "records path with wildcard and columns",
+			generic:  exporterconfig.Generic{RecordsPath: "data.items[*]", Columns: []exporterconfig.Column{{Name: "location", Path: "properties.location"}, {Name: "properties", Path: "$.missing"}}},
+			expected: "cost,id,location\n1.5,a,eu\n2,b,us\n",
+		},
+		{
+			name:     "no records",
+			generic:  exporterconfig.Generic{RecordsPath: "$.data.missing"},
+			expected: "",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := exporterconfig.Config{}
+			config.Options.Generic = tc.generic
+			csvData, err := TryParseUnknownJSONToCSV(input, config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(csvData) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, csvData)
+			}
+		})
+	}
+}
+
+func TestJSONRecordsToCSVFlatten(t *testing.T) {
+	input := []byte(`[
+		{ "id": "a", "tags": { "team": "x", "env": { "name": "prod" } }, "zones": ["1", "2"], "usage": [{ "unit": "h", "value": 1 }, { "unit": "gb", "value": 2 }] },
+		{ "id": "b", "zones": [], "usage": [] }
+	]`)
+
+	tests := []struct {
+		name     string
+		flatten  exporterconfig.Flatten
+		expected string
+	}{
+		{
+			name:    "json arrays",
+			flatten: exporterconfig.Flatten{Arrays: exporterconfig.ArraysJSON},
+			expected: "id,tags.env.name,tags.team,usage,zones\n" +
+				"a,prod,x,\"[{\"\"unit\"\":\"\"h\"\",\"\"value\"\":1},{\"\"unit\"\":\"\"gb\"\",\"\"value\"\":2}]\",\"[\"\"1\"\",\"\"2\"\"]\"\n" +
+				"b,,,[],[]\n",
+		},
+		{
+			name:    "indexed arrays",
+			flatten: exporterconfig.Flatten{Separator: "_", Arrays: exporterconfig.ArraysIndex},
+			expected: "id,tags_env_name,tags_team,usage_0_unit,usage_0_value,usage_1_unit,usage_1_value,zones_0,zones_1\n" +
+				"a,prod,x,h,1,gb,2,1,2\n" +
+				"b,,,,,,,,\n",
+		},
+		{
+			name:    "exploded arrays",
+			flatten: exporterconfig.Flatten{Arrays: exporterconfig.ArraysExplode},
+			expected: "id,tags.env.name,tags.team,usage.unit,usage.value,zones\n" +
+				"a,prod,x,h,1,1\n" +
+				"a,prod,x,gb,2,1\n" +
+				"a,prod,x,h,1,2\n" +
+				"a,prod,x,gb,2,2\n" +
+				"b,,,,,\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := exporterconfig.Config{}
+			config.Options.Generic.Flatten = tc.flatten
+			csvData, err := TryParseUnknownJSONToCSV(input, config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(csvData) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, csvData)
+			}
+		})
+	}
+}
+
+func TestSanitizePrometheusLabel(t *testing.T) {
+	tests := map[string]string{
+		"__name__":  "metric_name",
+		"__foo__":   "foo",
+		"_job":      "job",
+		"1abc":      "label_1abc",
+		"":          "label",
+		"___":       "label",
+		"pod-name":  "pod_name",
+		"k8s.io/os": "k8s_io_os",
+		"instance":  "instance",
+	}
+	for label, expected := range tests {
+		if got := sanitizePrometheusLabel(label); got != expected {
+			t.Errorf("%q: expected %s, got %s", label, expected, got)
+		}
+	}
+}
@@ -4,14 +4,14 @@ import (
 	"fmt"
 	"strings"
 
-	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
 	helpers "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers"
 	"github.com/rs/zerolog/log"
 )
 
 type JsonHandler struct{}
 
-func (r *JsonHandler) Resolve(config finopsdatatypes.ExporterScraperConfig, data []byte) ([]byte, error) {
+func (r *JsonHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
 	log.Logger.Info().Msg("Detected json content-type")
 	var jsonDataParsed []byte
 	var err error
@@ -19,6 +19,9 @@ func (r *JsonHandler) Resolve(config finopsdatatypes.ExporterScraperConfig, data
 		jsonDataParsed, err = helpers.TryParseResponseAsFocusJSON(data)
 	} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "resource" {
 		jsonDataParsed, err = helpers.TryParseResponseAsMetricsJSON(data, config)
+	} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "generic" && config.Options.Generic.RecordsPath != "" {
+		// The records are explicitly selected, the response is not Prometheus JSON
+		jsonDataParsed, err = helpers.TryParseUnknownJSONToCSV(data, config)
 	} else if strings.ToLower(config.Spec.ExporterConfig.MetricType) == "generic" {
 		jsonDataParsed, err = helpers.TryParseUnknownJSONToPrometheusCSV(data, config)
 		if err != nil {
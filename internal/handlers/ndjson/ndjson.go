@@ -0,0 +1,69 @@
+package ndjson
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	helpers "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers"
+)
+
+// NdjsonHandler converts newline delimited JSON (JSON Lines), one object per
+// line, into CSV. The header is the union of the keys of all the objects,
+// like for the arrays of objects of the generic JSON parser.
+type NdjsonHandler struct{}
+
+func (r *NdjsonHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
+	return r.resolve(config, bytes.NewReader(data))
+}
+
+// Stream decodes the objects line by line while they are read, but the input
+// is still buffered as a whole: the header is the union of the keys of all the
+// objects, so the CSV can only be produced after the last line.
+func (r *NdjsonHandler) Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error) {
+	resolved, err := r.resolve(config, data)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(resolved), nil
+}
+
+func (r *NdjsonHandler) resolve(config exporterconfig.Config, data io.Reader) ([]byte, error) {
+	log.Logger.Info().Msg("Detected ndjson content-type")
+	records, err := readObjects(data)
+	if err != nil {
+		return nil, fmt.Errorf("an error has occured while parsing ndjson data: %w", err)
+	}
+	if len(records) == 0 {
+		log.Logger.Warn().Msg("NDJSON contains no records")
+		return []byte{}, nil
+	}
+	return helpers.JSONRecordsToCSV(records, config.Options.Generic)
+}
+
+// readObjects decodes one JSON object per line, skipping the empty lines
+func readObjects(data io.Reader) ([]map[string]interface{}, error) {
+	reader := bufio.NewReader(data)
+	records := []map[string]interface{}{}
+	for line := 1; ; line++ {
+		content, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 {
+			record := map[string]interface{}{}
+			if err := helpers.DecodeJSON(trimmed, &record); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			records = append(records, record)
+		}
+		if errors.Is(err, io.EOF) {
+			return records, nil
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ndjson
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestStream(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "union of keys",
+			input:    "{\"id\": \"a\", \"cost\": 1.5}\n\n{\"id\": \"b\", \"cost\": 2, \"region\": \"eu\"}\r\n{\"id\": \"c\", \"cost\": null}",
+			expected: "cost,id,region\n1.5,a,\n2,b,eu\n,c,\n",
+		},
+		{
+			name:     "empty",
+			input:    "\n\n",
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &NdjsonHandler{}
+			reader, err := handler.Stream(exporterconfig.Config{}, strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			output, _ := io.ReadAll(reader)
+			if string(output) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestStreamInvalid(t *testing.T) {
+	handler := &NdjsonHandler{}
+	_, err := handler.Stream(exporterconfig.Config{}, strings.NewReader("{\"id\": \"a\"}\n[1, 2]\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("expected an error at line 2, got %v", err)
+	}
+}
@@ -1,32 +1,48 @@
 package octet
 
 import (
-	"strings"
+	"bytes"
+	"io"
 
 	"github.com/rs/zerolog/log"
 
-	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
-
-	csvhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/csv"
-	jsonhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/json"
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/sniff"
 )
 
+// OctetHandler detects the format from the content of the data, unless the
+// compression and the format are forced by the configuration
 type OctetHandler struct{}
 
-func (r *OctetHandler) Resolve(config finopsdatatypes.ExporterScraperConfig, data []byte) ([]byte, error) {
-	log.Logger.Warn().Msg("Generic Content-Type: inferring from URL extension")
-	switch {
-	case strings.Contains(strings.ToLower(config.Spec.ExporterConfig.API.Path), "csv"):
-		log.Logger.Warn().Msg("Generic Content-Type: inferring from URL extension, found CSV")
-		handler := &csvhandler.CsvHandler{}
-		return handler.Resolve(config, data)
-	case strings.Contains(strings.ToLower(config.Spec.ExporterConfig.API.Path), "json"):
-		log.Logger.Warn().Msg("Generic Content-Type: inferring from URL extension, found JSON")
-		handler := &jsonhandler.JsonHandler{}
-		return handler.Resolve(config, data)
-	default:
-		log.Logger.Warn().Msg("Generic Content-Type: inferring from URL extension, nothign found, trying text/csv")
-		handler := &csvhandler.CsvHandler{}
-		return handler.Resolve(config, data)
+func (r *OctetHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
+	reader, err := r.Stream(config, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+func (r *OctetHandler) Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error) {
+	reader, _, err := r.StreamRoute(config, data)
+	return reader, err
+}
+
+// StreamRoute detects the format from the content of the data, since the
+// Content-Type does not describe it
+func (r *OctetHandler) StreamRoute(config exporterconfig.Config, data io.Reader) (io.Reader, string, error) {
+	plan := sniff.Plan{
+		Compression: sniff.Format(config.Options.Compression),
+		Format:      sniff.Format(config.Options.Format),
+	}
+	if plan.Compression != sniff.Unknown || plan.Format != sniff.Unknown {
+		log.Logger.Info().Msgf("Format forced by the configuration: compression %q, format %q", plan.Compression, plan.Format)
+	} else {
+		log.Logger.Warn().Msg("Generic Content-Type: inferring from the content")
+	}
+	reader, route, err := sniff.StreamPlan(config, data, plan)
+	if err != nil {
+		return nil, route.String(), err
 	}
+	log.Logger.Info().Msgf("Generic Content-Type: found %s", route)
+	return reader, route.String(), nil
 }
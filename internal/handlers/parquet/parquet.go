@@ -0,0 +1,293 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+// Magic is the sequence of bytes at the beginning (and at the end) of every
+// Parquet file
+const Magic = "PAR1"
+
+// rowsPerRead is the number of rows converted at a time
+const rowsPerRead = 128
+
+type ParquetHandler struct{}
+
+func (r *ParquetHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
+	log.Logger.Info().Msg("Detected parquet content-type")
+	reader, err := newCSVReader(data)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// Stream converts the row groups into CSV while it is read. The metadata of
+// Parquet files is stored at the end, so the file itself is buffered, but the
+// CSV representation is never held in memory as a whole.
+func (r *ParquetHandler) Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error) {
+	log.Logger.Info().Msg("Detected parquet content-type")
+	buffered, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	return newCSVReader(buffered)
+}
+
+// column is a top-level field of the schema and the range of leaf columns
+// holding its values
+type column struct {
+	name   string
+	node   parquet.Node
+	leaves []parquet.LeafColumn
+	first  int
+}
+
+// csvReader produces the CSV representation of a Parquet file: the header is
+// the list of top-level fields, nested fields (maps, lists and groups) are
+// encoded as JSON.
+type csvReader struct {
+	reader  *parquet.Reader
+	columns []column
+	rows    []parquet.Row
+
+	buffer bytes.Buffer
+	writer *csv.Writer
+	done   bool
+}
+
+func newCSVReader(data []byte) (*csvReader, error) {
+	file, err := parquet.OpenFile(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("could not open parquet file: %w", err)
+	}
+
+	schema := file.Schema()
+	columns := []column{}
+	for i, path := range schema.Columns() {
+		leaf, ok := schema.Lookup(path...)
+		if !ok {
+			continue
+		}
+		if len(columns) == 0 || columns[len(columns)-1].name != path[0] {
+			node := leaf.Node
+			for _, field := range schema.Fields() {
+				if field.Name() == path[0] {
+					node = field
+					break
+				}
+			}
+			columns = append(columns, column{name: path[0], node: node, first: i})
+		}
+		columns[len(columns)-1].leaves = append(columns[len(columns)-1].leaves, leaf)
+	}
+
+	r := &csvReader{
+		reader:  parquet.NewReader(file),
+		columns: columns,
+		rows:    make([]parquet.Row, rowsPerRead),
+	}
+	r.writer = csv.NewWriter(&r.buffer)
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.name
+	}
+	if err := r.writer.Write(header); err != nil {
+		return nil, err
+	}
+	r.writer.Flush()
+	return r, nil
+}
+
+func (r *csvReader) Read(p []byte) (int, error) {
+	for r.buffer.Len() == 0 && !r.done {
+		if err := r.fill(); err != nil {
+			return 0, err
+		}
+	}
+	if r.buffer.Len() == 0 {
+		return 0, io.EOF
+	}
+	return r.buffer.Read(p)
+}
+
+// fill converts the next rows of the file into the buffer
+func (r *csvReader) fill() error {
+	n, err := r.reader.ReadRows(r.rows)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("could not read parquet rows: %w", err)
+	}
+	if n == 0 || errors.Is(err, io.EOF) {
+		r.done = true
+	}
+
+	record := make([]string, len(r.columns))
+	for _, row := range r.rows[:n] {
+		for i := range record {
+			record[i] = ""
+		}
+		values := map[int][]parquet.Value{}
+		row.Range(func(columnIndex int, columnValues []parquet.Value) bool {
+			values[columnIndex] = columnValues
+			return true
+		})
+		for i, c := range r.columns {
+			record[i] = formatColumn(c, values)
+		}
+		if err := r.writer.Write(record); err != nil {
+			return err
+		}
+	}
+	r.writer.Flush()
+	return r.writer.Error()
+}
+
+// formatColumn returns the string representation of a top-level field
+func formatColumn(c column, values map[int][]parquet.Value) string {
+	if c.node.Leaf() {
+		leafValues := values[c.first]
+		if len(leafValues) == 0 {
+			return ""
+		}
+		return formatValue(c.node, leafValues[0])
+	}
+
+	var nested any
+	logicalType := c.node.Type().LogicalType()
+	switch {
+	case logicalType != nil && logicalType.Map != nil && len(c.leaves) == 2:
+		keys := values[c.leaves[0].ColumnIndex]
+		items := values[c.leaves[1].ColumnIndex]
+		object := map[string]string{}
+		for i, key := range keys {
+			if key.IsNull() || i >= len(items) {
+				continue
+			}
+			object[formatValue(c.leaves[0].Node, key)] = formatValue(c.leaves[1].Node, items[i])
+		}
+		nested = object
+	case len(c.leaves) == 1:
+		list := []string{}
+		for _, v := range values[c.leaves[0].ColumnIndex] {
+			if !v.IsNull() {
+				list = append(list, formatValue(c.leaves[0].Node, v))
+			}
+		}
+		nested = list
+	default:
+		object := map[string]any{}
+		for _, leaf := range c.leaves {
+			key := leaf.Path[len(leaf.Path)-1]
+			leafValues := []string{}
+			for _, v := range values[leaf.ColumnIndex] {
+				if !v.IsNull() {
+					leafValues = append(leafValues, formatValue(leaf.Node, v))
+				}
+			}
+			if leaf.MaxRepetitionLevel > 0 {
+				object[key] = leafValues
+			} else if len(leafValues) > 0 {
+				object[key] = leafValues[0]
+			}
+		}
+		nested = object
+	}
+	encoded, err := json.Marshal(nested)
+	if err != nil {
+		return ""
+	}
+	return string(encoded)
+}
+
+// formatValue returns the string representation of a leaf value according to
+// its logical type
+func formatValue(node parquet.Node, v parquet.Value) string {
+	if v.IsNull() {
+		return ""
+	}
+	logicalType := node.Type().LogicalType()
+
+	switch v.Kind() {
+	case parquet.Boolean:
+		return strconv.FormatBool(v.Boolean())
+	case parquet.Int32, parquet.Int64:
+		switch {
+		case logicalType != nil && logicalType.Timestamp != nil:
+			return formatTimestamp(v.Int64(), &logicalType.Timestamp.Unit)
+		case logicalType != nil && logicalType.Date != nil:
+			return time.Unix(int64(v.Int32())*24*60*60, 0).UTC().Format(time.DateOnly)
+		case logicalType != nil && logicalType.Decimal != nil:
+			return formatDecimal(big.NewInt(v.Int64()), logicalType.Decimal.Scale)
+		case logicalType != nil && logicalType.Integer != nil && !logicalType.Integer.IsSigned:
+			// INT32 values are stored sign extended
+			if v.Kind() == parquet.Int32 {
+				return strconv.FormatUint(uint64(v.Uint32()), 10)
+			}
+			return strconv.FormatUint(v.Uint64(), 10)
+		}
+		return strconv.FormatInt(v.Int64(), 10)
+	case parquet.Int96:
+		// Legacy timestamps: nanoseconds of the day and Julian day
+		i := v.Int96()
+		nanos := int64(i[1])<<32 | int64(i[0])
+		days := int64(i[2]) - 2440588
+		return time.Unix(days*24*60*60, nanos).UTC().Format(time.RFC3339Nano)
+	case parquet.Float:
+		return strconv.FormatFloat(float64(v.Float()), 'f', -1, 32)
+	case parquet.Double:
+		return strconv.FormatFloat(v.Double(), 'f', -1, 64)
+	case parquet.ByteArray, parquet.FixedLenByteArray:
+		if logicalType != nil && logicalType.Decimal != nil {
+			return formatDecimal(twosComplement(v.ByteArray()), logicalType.Decimal.Scale)
+		}
+		return string(v.ByteArray())
+	}
+	return v.String()
+}
+
+func formatTimestamp(value int64, unit *format.TimeUnit) string {
+	var t time.Time
+	switch {
+	case unit.Millis != nil:
+		t = time.UnixMilli(value)
+	case unit.Micros != nil:
+		t = time.UnixMicro(value)
+	default:
+		t = time.Unix(0, value)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// formatDecimal formats the unscaled value of a decimal with the given scale
+func formatDecimal(unscaled *big.Int, scale int32) string {
+	value := new(big.Float).SetInt(unscaled)
+	if scale > 0 {
+		divisor := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+		value.Quo(value, divisor)
+	}
+	return value.Text('f', int(max(scale, 0)))
+}
+
+// twosComplement decodes a big-endian two's complement integer
+func twosComplement(b []byte) *big.Int {
+	value := new(big.Int).SetBytes(b)
+	if len(b) > 0 && b[0]&0x80 != 0 {
+		value.Sub(value, new(big.Int).Lsh(big.NewInt(1), uint(len(b)*8)))
+	}
+	return value
+}
@@ -0,0 +1,116 @@
+package parquet
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+type costRow struct {
+	ResourceId     string            `parquet:"ResourceId"`
+	BilledCost     float64           `parquet:"BilledCost"`
+	Quantity       int64             `parquet:"Quantity,optional"`
+	ChargePeriod   time.Time         `parquet:"ChargePeriodStart,timestamp(millisecond)"`
+	BillingDate    int32             `parquet:"BillingDate,date"`
+	Tags           map[string]string `parquet:"Tags"`
+	Discontinued   bool              `parquet:"Discontinued"`
+	CommitmentList []string          `parquet:"Commitments,list"`
+}
+
+func writeParquet(t *testing.T, rows []costRow) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := parquet.NewGenericWriter[costRow](&buffer)
+	if _, err := writer.Write(rows); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestResolve(t *testing.T) {
+	data := writeParquet(t, []costRow{
+		{
+			ResourceId:     "vm-1",
+			BilledCost:     1.25,
+			Quantity:       3,
+			ChargePeriod:   time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+			BillingDate:    20089,
+			Tags:           map[string]string{"env": "prod"},
+			CommitmentList: []string{"a", "b"},
+		},
+		{
+			ResourceId:   "vm-2",
+			BilledCost:   0.5,
+			ChargePeriod: time.Date(2025, 1, 3, 0, 0, 0, 0, time.UTC),
+			Discontinued: true,
+		},
+	})
+
+	handler := &ParquetHandler{}
+	output, err := handler.Resolve(exporterconfig.Config{}, data)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	expected := "ResourceId,BilledCost,Quantity,ChargePeriodStart,BillingDate,Tags,Discontinued,Commitments\n" +
+		"vm-1,1.25,3,2025-01-02T03:04:05Z,2025-01-01,\"{\"\"env\"\":\"\"prod\"\"}\",false,\"[\"\"a\"\",\"\"b\"\"]\"\n" +
+		"vm-2,0.5,,2025-01-03T00:00:00Z,1970-01-01,{},true,[]\n"
+	if string(output) != expected {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", output, expected)
+	}
+}
+
+func TestStream(t *testing.T) {
+	rows := make([]costRow, 1000)
+	for i := range rows {
+		rows[i] = costRow{ResourceId: "vm", BilledCost: float64(i)}
+	}
+	data := writeParquet(t, rows)
+
+	handler := &ParquetHandler{}
+	reader, err := handler.Stream(exporterconfig.Config{}, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if lines := bytes.Count(output, []byte("\n")); lines != len(rows)+1 {
+		t.Errorf("expected %d lines, got %d", len(rows)+1, lines)
+	}
+}
+
+func TestFormatValueUnsigned(t *testing.T) {
+	tests := []struct {
+		node     parquet.Node
+		value    parquet.Value
+		expected string
+	}{
+		// INT32 values are sign extended, e.g., 2^31 is read as math.MinInt32
+		{parquet.Uint(32), parquet.Int32Value(math.MinInt32), "2147483648"},
+		{parquet.Uint(64), parquet.Int64Value(math.MinInt64), "9223372036854775808"},
+		{parquet.Int(32), parquet.Int32Value(-1), "-1"},
+	}
+	for _, tt := range tests {
+		if got := formatValue(tt.node, tt.value); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.node, tt.expected, got)
+		}
+	}
+}
+
+func TestResolveInvalid(t *testing.T) {
+	handler := &ParquetHandler{}
+	if _, err := handler.Resolve(exporterconfig.Config{}, []byte("PAR1 not really")); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+}
@@ -0,0 +1,175 @@
+package sniff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+// nextPart returns the name and the content of the next part of an archive,
+// or io.EOF after the last one
+type nextPart func() (string, io.Reader, error)
+
+// streamZip merges the parts of a zip archive. The central directory of zip
+// archives is stored at the end, so the archive is buffered.
+func streamZip(config exporterconfig.Config, data io.Reader, route Route, plan Plan) (io.Reader, Route, error) {
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return nil, route, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		return nil, route, fmt.Errorf("could not open zip archive: %w", err)
+	}
+
+	files := archive.File
+	var current io.ReadCloser
+	return merge(config, route, plan, func() (string, io.Reader, error) {
+		if current != nil {
+			current.Close()
+			current = nil
+		}
+		for len(files) > 0 {
+			file := files[0]
+			files = files[1:]
+			if file.FileInfo().IsDir() || isHidden(file.Name) {
+				continue
+			}
+			if current, err = file.Open(); err != nil {
+				return "", nil, fmt.Errorf("could not open %s: %w", file.Name, err)
+			}
+			return file.Name, current, nil
+		}
+		return "", nil, io.EOF
+	})
+}
+
+// streamTar merges the parts of a tar archive while it is read
+func streamTar(config exporterconfig.Config, data io.Reader, route Route, plan Plan) (io.Reader, Route, error) {
+	archive := tar.NewReader(data)
+	return merge(config, route, plan, func() (string, io.Reader, error) {
+		for {
+			header, err := archive.Next()
+			if err != nil {
+				return "", nil, err
+			}
+			if header.Typeflag != tar.TypeReg || isHidden(header.Name) {
+				continue
+			}
+			return header.Name, archive, nil
+		}
+	})
+}
+
+// isHidden tells whether an entry of an archive is metadata added by the
+// archiver (e.g., __MACOSX/ or ._ files)
+func isHidden(name string) bool {
+	return strings.HasPrefix(path.Base(name), ".") || strings.Contains(name, "__MACOSX/")
+}
+
+// mergeReader concatenates the CSV of the parts of an archive into a single
+// record stream, keeping only the header of the first part. Parts that cannot
+// be converted or with a different header are skipped.
+type mergeReader struct {
+	config exporterconfig.Config
+	next   nextPart
+	prefix Route
+	plan   Plan
+
+	route   Route
+	header  string
+	current io.Reader
+	last    byte
+}
+
+// merge returns the merged record stream of the parts and the route of the
+// first part. The first part is opened immediately, so that its errors are
+// reported before reading.
+func merge(config exporterconfig.Config, route Route, plan Plan, next nextPart) (io.Reader, Route, error) {
+	m := &mergeReader{config: config, next: next, prefix: route, plan: plan}
+	if err := m.advance(); err != nil {
+		return nil, route, err
+	}
+	if m.route == nil {
+		log.Logger.Warn().Msgf("The %s archive contains no data", route[len(route)-1])
+		return bytes.NewReader(nil), route, nil
+	}
+	return m, m.route, nil
+}
+
+func (m *mergeReader) Read(p []byte) (int, error) {
+	for m.current != nil {
+		n, err := m.current.Read(p)
+		if n > 0 {
+			m.last = p[n-1]
+			return n, nil
+		}
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+		if err := m.advance(); err != nil {
+			return 0, err
+		}
+	}
+	return 0, io.EOF
+}
+
+// advance opens the next part with the same header of the first one
+func (m *mergeReader) advance() error {
+	m.current = nil
+	for {
+		name, data, err := m.next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		csvData, route, err := stream(m.config, data, name, m.prefix, m.plan)
+		if err != nil {
+			// e.g., the manifest of the export
+			log.Logger.Warn().Err(err).Msgf("Skipping part %s, it could not be converted", name)
+			continue
+		}
+		buffered := bufio.NewReader(csvData)
+		line, err := buffered.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		header := strings.TrimRight(strings.TrimPrefix(line, "\xef\xbb\xbf"), "\r\n")
+		if header == "" {
+			log.Logger.Debug().Msgf("Skipping empty part %s", name)
+			continue
+		}
+
+		if m.route == nil {
+			m.route, m.header = route, header
+			m.current = io.MultiReader(strings.NewReader(header+"\n"), buffered)
+			return nil
+		}
+		if header != m.header {
+			log.Logger.Warn().Msgf("Skipping part %s, its header does not match the one of the first part", name)
+			continue
+		}
+		log.Logger.Debug().Msgf("Merging part %s", name)
+		m.current = buffered
+		if m.last != '\n' {
+			m.current = io.MultiReader(strings.NewReader("\n"), buffered)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,135 @@
+package sniff
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+type file struct {
+	name    string
+	content string
+}
+
+func zipArchive(t *testing.T, files []file) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for _, f := range files {
+		w, err := writer.Create(f.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(f.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func tarGzArchive(t *testing.T, files []file) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	gw := gzip.NewWriter(&buffer)
+	writer := tar.NewWriter(gw)
+	writer.WriteHeader(&tar.Header{Name: "export/", Typeflag: tar.TypeDir, Mode: 0755})
+	for _, f := range files {
+		writer.WriteHeader(&tar.Header{Name: f.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(f.content))})
+		writer.Write([]byte(f.content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gw.Close()
+	return buffer.Bytes()
+}
+
+func gzipped(content string) string {
+	var buffer bytes.Buffer
+	gw := gzip.NewWriter(&buffer)
+	gw.Write([]byte(content))
+	gw.Close()
+	return buffer.String()
+}
+
+func zstdCompressed(t *testing.T, content string) []byte {
+	t.Helper()
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll([]byte(content), nil)
+}
+
+func TestStreamArchives(t *testing.T) {
+	parts := []file{
+		{"export/part-0.csv", "a,b\n1,2\n"},
+		{"export/._part-0.csv", "garbage"},
+		{"export/part-1.csv.gz", gzipped("a,b\n3,4")},
+		{"export/manifest.json", `{"parts": 2}`},
+		{"export/empty.csv", ""},
+		{"export/part-2.csv", "\xef\xbb\xbfa,b\r\n5,6\r\n"},
+	}
+
+	// bzip2 compression of "a,b\n1,2\n", the standard library cannot write it
+	bzip2 := []byte{
+		0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0xbf, 0x87,
+		0x40, 0x7f, 0x00, 0x00, 0x03, 0x59, 0x00, 0x00, 0x10, 0x00, 0x04, 0x30,
+		0x00, 0x30, 0x00, 0x20, 0x00, 0x30, 0xc0, 0x08, 0x69, 0xb2, 0x88, 0x23,
+		0x27, 0x8b, 0xb9, 0x22, 0x9c, 0x28, 0x48, 0x5f, 0xc3, 0xa0, 0x3f, 0x80,
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		route    string
+		expected string
+	}{
+		{"zip", zipArchive(t, parts), "zip > csv", "a,b\n1,2\n3,4\n5,6\r\n"},
+		{"tar.gz", tarGzArchive(t, parts), "gzip > tar > csv", "a,b\n1,2\n3,4\n5,6\r\n"},
+		{"empty zip", zipArchive(t, nil), "zip", ""},
+		{"zstd", zstdCompressed(t, "a,b\n1,2\n"), "zstd > csv", "a,b\n1,2\n"},
+		{"bzip2", bzip2, "bzip2 > csv", "a,b\n1,2\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := exporterconfig.Config{}
+			config.Spec.ExporterConfig.MetricType = "generic"
+			config.Spec.ExporterConfig.API.Path = "/export"
+			reader, route, err := Stream(config, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if route.String() != tt.route {
+				t.Errorf("expected route %q, got %q", tt.route, route)
+			}
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestStreamNestedLimit(t *testing.T) {
+	data := "a,b\n1,2\n"
+	for i := 0; i < maxLayers; i++ {
+		data = gzipped(data)
+	}
+	config := exporterconfig.Config{}
+	if _, _, err := Stream(config, bytes.NewReader([]byte(data))); err == nil {
+		t.Error("expected an error for too many nested compressions")
+	}
+}
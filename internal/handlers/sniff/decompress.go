@@ -0,0 +1,38 @@
+package sniff
+
+import (
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// decode removes a compression or converts the encoding of the data to UTF-8
+// while it is read
+func decode(format Format, data io.Reader) (io.Reader, error) {
+	switch format {
+	case Gzip:
+		reader, err := gzip.NewReader(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not obtain new gzip reader: %w", err)
+		}
+		return reader, nil
+	case Zstd:
+		// A single decoder does not start goroutines, which would otherwise
+		// need the decoder to be closed
+		reader, err := zstd.NewReader(data, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("could not obtain new zstd reader: %w", err)
+		}
+		return reader, nil
+	case Bzip2:
+		return bzip2.NewReader(data), nil
+	case UTF16:
+		return transform.NewReader(data, unicode.BOMOverride(unicode.UTF8.NewDecoder())), nil
+	}
+	return nil, fmt.Errorf("%s compression is not supported", format)
+}
@@ -0,0 +1,168 @@
+package sniff
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers"
+	csvhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/csv"
+	jsonhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/json"
+	ndjsonhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/ndjson"
+	parquethandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/parquet"
+	tsvhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/tsv"
+)
+
+// maxLayers is the maximum number of compressions, archives and encodings
+// wrapping the data, to refuse maliciously nested archives
+const maxLayers = 4
+
+// Route lists the formats detected in the data, from the outermost
+// compression to the parser
+type Route []Format
+
+func (r Route) String() string {
+	formats := make([]string, len(r))
+	for i, format := range r {
+		formats[i] = string(format)
+	}
+	return strings.Join(formats, " > ")
+}
+
+// Plan forces the compression and the format of the data instead of
+// detecting them, the empty ones are still detected
+type Plan struct {
+	Compression Format
+	Format      Format
+}
+
+// Stream detects the format of the data and converts it into CSV: the
+// compressions are removed while the data is read, until the format of the
+// content is found, and the parts of archives are merged. The extension of
+// the API path is considered only when the content is ambiguous.
+func Stream(config exporterconfig.Config, data io.Reader) (io.Reader, Route, error) {
+	return StreamPlan(config, data, Plan{})
+}
+
+// StreamPlan is Stream with the compression and the format forced by the
+// plan. Further compressions and archives are still detected, e.g., with a
+// csv format the gzipped data is decompressed first.
+func StreamPlan(config exporterconfig.Config, data io.Reader, plan Plan) (io.Reader, Route, error) {
+	name := config.Spec.ExporterConfig.API.Path
+	if u, err := url.Parse(name); err == nil {
+		name = u.Path
+	}
+	return stream(config, data, name, Route{}, plan)
+}
+
+// stream converts the data named name, found after the given route
+func stream(config exporterconfig.Config, data io.Reader, name string, route Route, plan Plan) (io.Reader, Route, error) {
+	for {
+		buffered := bufio.NewReaderSize(data, PeekSize)
+		prefix, err := buffered.Peek(PeekSize)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, route, err
+		}
+		if len(prefix) == 0 {
+			return bytes.NewReader(nil), append(route[:len(route):len(route)], CSV), nil
+		}
+
+		format := Detect(prefix)
+		switch {
+		case plan.Compression != Unknown:
+			format, plan.Compression = plan.Compression, Unknown
+		case isLayer(format):
+		case plan.Format != Unknown:
+			format = plan.Format
+		case format == Unknown:
+			if format = FromExtension(name); format != Unknown {
+				log.Logger.Warn().Msgf("Could not detect the format from the content, using the extension of %s: %s", name, format)
+				break
+			}
+			// Text that is not JSON is read as CSV, e.g., a single column
+			if !isText(bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf"))) {
+				return nil, route, fmt.Errorf("could not detect the format of the data after %q", route.String())
+			}
+			format = CSV
+			log.Logger.Warn().Msgf("Could not detect the format from the content, reading it as %s", format)
+		}
+		// The parts of archives share the route of the archive
+		route = append(route[:len(route):len(route)], format)
+		if len(route) > maxLayers {
+			return nil, route, fmt.Errorf("too many nested compressions: %s", route)
+		}
+
+		switch format {
+		case Gzip, Zstd, Bzip2, UTF16:
+			if data, err = decode(format, buffered); err != nil {
+				return nil, route, err
+			}
+			if FromExtension(name) == format {
+				name = strings.TrimSuffix(name, path.Ext(name))
+			}
+		case Zip:
+			return streamZip(config, buffered, route, plan)
+		case Tar:
+			return streamTar(config, buffered, route, plan)
+		default:
+			handler, ok := handlerFor(format)
+			if !ok {
+				return nil, route, fmt.Errorf("%s format is not supported", format)
+			}
+			reader, err := convert(config, handler, buffered)
+			return reader, route, err
+		}
+	}
+}
+
+// isLayer tells whether the format wraps another format
+func isLayer(format Format) bool {
+	switch format {
+	case Gzip, Zstd, Bzip2, Zip, Tar, UTF16:
+		return true
+	}
+	return false
+}
+
+// handlerFor returns the handler converting the format into CSV
+func handlerFor(format Format) (handlers.Handler, bool) {
+	switch format {
+	case CSV:
+		return &csvhandler.CsvHandler{}, true
+	case TSV:
+		return &tsvhandler.TsvHandler{}, true
+	case JSON:
+		return &jsonhandler.JsonHandler{}, true
+	case NDJSON:
+		return &ndjsonhandler.NdjsonHandler{}, true
+	case Parquet:
+		return &parquethandler.ParquetHandler{}, true
+	}
+	return nil, false
+}
+
+// convert converts the data into CSV, streaming it when the handler supports
+// it
+func convert(config exporterconfig.Config, handler handlers.Handler, data io.Reader) (io.Reader, error) {
+	if streamHandler, ok := handler.(handlers.StreamHandler); ok {
+		return streamHandler.Stream(config, data)
+	}
+	// e.g., JSON documents need to be parsed as a whole
+	body, err := io.ReadAll(data)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := handler.Resolve(config, body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(resolved), nil
+}
@@ -0,0 +1,182 @@
+// Package sniff detects the format of a response from its first bytes, so
+// that responses with a generic Content-Type (e.g., application/octet-stream)
+// can be decompressed and parsed without relying on the API path.
+package sniff
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	parquethandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/parquet"
+)
+
+// Format is a compression or a data format detected from the content
+type Format string
+
+const (
+	Unknown Format = ""
+	Gzip    Format = "gzip"
+	Zstd    Format = "zstd"
+	Bzip2   Format = "bzip2"
+	Zip     Format = "zip"
+	Tar     Format = "tar"
+	Parquet Format = "parquet"
+	JSON    Format = "json"
+	NDJSON  Format = "ndjson"
+	UTF16   Format = "utf-16"
+	CSV     Format = "csv"
+	TSV     Format = "tsv"
+)
+
+// PeekSize is the number of bytes inspected to detect the format
+const PeekSize = 4096
+
+// tarMagicOffset is the position of the "ustar" magic in the header of the
+// first entry of tar archives
+const tarMagicOffset = 257
+
+var magics = []struct {
+	magic  []byte
+	format Format
+}{
+	{[]byte{0x1f, 0x8b}, Gzip},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, Zstd},
+	{[]byte("PK\x03\x04"), Zip},
+	{[]byte("PK\x05\x06"), Zip},
+	{[]byte("BZh"), Bzip2},
+	{[]byte(parquethandler.Magic), Parquet},
+	{[]byte{0xff, 0xfe}, UTF16},
+	{[]byte{0xfe, 0xff}, UTF16},
+}
+
+// Detect returns the format of the data from its first bytes: compressions
+// and binary formats are recognized by their magic bytes, JSON by its first
+// character, NDJSON by an object per line and CSV and TSV by the number of
+// fields of their header.
+func Detect(prefix []byte) Format {
+	for _, m := range magics {
+		if bytes.HasPrefix(prefix, m.magic) {
+			if m.format == Bzip2 && !isBzip2(prefix) {
+				continue
+			}
+			return m.format
+		}
+	}
+	if len(prefix) >= tarMagicOffset+5 && bytes.Equal(prefix[tarMagicOffset:tarMagicOffset+5], []byte("ustar")) {
+		return Tar
+	}
+
+	text := bytes.TrimPrefix(prefix, []byte("\xef\xbb\xbf"))
+	if !isText(text) {
+		return Unknown
+	}
+	trimmed := bytes.TrimLeft(text, " \t\r\n")
+	if len(trimmed) > 0 && trimmed[0] == '{' && isNDJSON(trimmed) {
+		return NDJSON
+	}
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return JSON
+	}
+	commas, tabs := fields(text, ','), fields(text, '\t')
+	switch {
+	case tabs > commas:
+		return TSV
+	case commas > 0:
+		return CSV
+	}
+	return Unknown
+}
+
+// FromExtension returns the format suggested by the extension of the path,
+// ignoring the query string. It is used only when the content is ambiguous.
+func FromExtension(apiPath string) Format {
+	if u, err := url.Parse(apiPath); err == nil {
+		apiPath = u.Path
+	}
+	switch strings.ToLower(path.Ext(apiPath)) {
+	case ".gz", ".gzip":
+		return Gzip
+	case ".zst", ".zstd":
+		return Zstd
+	case ".bz2":
+		return Bzip2
+	case ".zip":
+		return Zip
+	case ".tar":
+		return Tar
+	case ".tgz":
+		return Gzip
+	case ".parquet":
+		return Parquet
+	case ".json":
+		return JSON
+	case ".csv":
+		return CSV
+	case ".tsv":
+		return TSV
+	case ".ndjson", ".jsonl":
+		return NDJSON
+	}
+	return Unknown
+}
+
+// isNDJSON tells whether the first line of the data is a complete JSON
+// object followed by another object, since a document on a single line is
+// more likely plain JSON
+func isNDJSON(data []byte) bool {
+	first, rest, found := bytes.Cut(data, []byte("\n"))
+	if !found || !json.Valid(first) {
+		return false
+	}
+	rest = bytes.TrimLeft(rest, " \t\r\n")
+	return len(rest) > 0 && rest[0] == '{'
+}
+
+// isBzip2 tells whether the "BZh" magic is followed by a block size and by
+// the magic of a block or of the end of the stream, since it may be text
+func isBzip2(prefix []byte) bool {
+	if len(prefix) < 10 || prefix[3] < '1' || prefix[3] > '9' {
+		return false
+	}
+	return bytes.HasPrefix(prefix[4:], []byte{0x31, 0x41, 0x59, 0x26, 0x53, 0x59}) ||
+		bytes.HasPrefix(prefix[4:], []byte{0x17, 0x72, 0x45, 0x38, 0x50, 0x90})
+}
+
+// isText tells whether the data is UTF-8 text without control characters,
+// tolerating a rune truncated at the end
+func isText(data []byte) bool {
+	for i := 0; i < len(data); {
+		r, size := utf8.DecodeRune(data[i:])
+		if r == utf8.RuneError && size <= 1 {
+			return !utf8.FullRune(data[i:])
+		}
+		if r < 0x20 && r != '\t' && r != '\r' && r != '\n' {
+			return false
+		}
+		i += size
+	}
+	return true
+}
+
+// fields returns the number of fields of the header in the complete lines of
+// the data, separated by comma, or 0 if the header has less than two fields.
+// The following records may have a different number of fields, since the
+// ragged records are skipped when they are read.
+func fields(data []byte, comma rune) int {
+	if end := bytes.LastIndexByte(data, '\n'); end >= 0 {
+		data = data[:end+1]
+	}
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil || len(header) < 2 {
+		return 0
+	}
+	return len(header)
+}
@@ -0,0 +1,118 @@
+package sniff
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected Format
+	}{
+		{"gzip", []byte{0x1f, 0x8b, 0x08, 0x00}, Gzip},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, Zstd},
+		{"zip", []byte("PK\x03\x04\x14\x00"), Zip},
+		{"parquet", []byte("PAR1\x15\x04"), Parquet},
+		{"utf-16", []byte{0xff, 0xfe, 'a', 0x00}, UTF16},
+		{"json object", []byte(`{"value": []}`), JSON},
+		{"json array after spaces", []byte("\n  [{\"a\": 1}]"), JSON},
+		{"ndjson", []byte("{\"a\": 1}\n{\"a\": 2}\n{\"a\""), NDJSON},
+		{"pretty printed json", []byte("{\n  \"a\": {\n    \"b\": 1\n  }\n}"), JSON},
+		{"json after utf-8 bom", []byte("\xef\xbb\xbf[]"), JSON},
+		{"csv", []byte("a,b,c\n1,2,3\n4,5,6\n"), CSV},
+		{"csv truncated", []byte("a,b,c\n1,2,3\n4,\"5"), CSV},
+		{"csv quoted newline", []byte("a,b\n\"x\ny\",2\n"), CSV},
+		{"tsv", []byte("a\tb\tc\n1\t2\t3\n"), TSV},
+		{"tsv with commas", []byte("a\tb,c\td\n1\t2,3\t4\n"), TSV},
+		{"csv with tabs", []byte("a,b\tc,d\n1,2\t3,4\n"), CSV},
+		{"inconsistent fields", []byte("a,b,c\n1,2,3\n4,5\n"), CSV},
+		{"single column", []byte("hello\nworld\n"), Unknown},
+		{"binary", []byte{0x00, 0x01, 0x02, 0x03}, Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Detect(tt.data); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFromExtension(t *testing.T) {
+	tests := map[string]Format{
+		"/export/report.csv":                 CSV,
+		"/export/report.csv.gz?sig=abc.json": Gzip,
+		"/jsonapi/export":                    Unknown,
+		"https://bucket/data.PARQUET":        Parquet,
+	}
+	for path, expected := range tests {
+		if got := FromExtension(path); got != expected {
+			t.Errorf("%s: expected %q, got %q", path, expected, got)
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	gw.Write([]byte("a,b\n1,2\n"))
+	gw.Close()
+
+	utf16 := []byte{0xff, 0xfe}
+	for _, r := range "a,b\n1,2\n" {
+		utf16 = append(utf16, byte(r), 0x00)
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		data     []byte
+		route    string
+		expected string
+	}{
+		{"gzip csv", "/jsonapi/export", compressed.Bytes(), "gzip > csv", "a,b\n1,2\n"},
+		{"utf-16 csv", "/export", utf16, "utf-16 > csv", "a,b\n1,2\n"},
+		{"json", "/export.csv", []byte(`[{"a": 1, "b": 2}]`), "json", "a,b\n1,2\n"},
+		{"single column from extension", "/export/ids.csv?x=1", []byte("id\n1\n"), "csv", "id\n1\n"},
+		{"single column", "/export", []byte("id\n1\n"), "csv", "id\n1\n"},
+		{"ragged csv", "/export", []byte("a,b,c\n1,2,3\n4,5\n"), "csv", "a,b,c\n1,2,3\n4,5\n"},
+		{"empty", "/export", []byte{}, "csv", ""},
+		{"ndjson", "/export", []byte("{\"a\": 1}\n{\"b\": 2}\n"), "ndjson", "a,b\n1,\n,2\n"},
+		{"tsv", "/export", []byte("a\tb\n1\tx,y\n"), "tsv", "a,b\n1,\"x,y\"\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := exporterconfig.Config{}
+			config.Spec.ExporterConfig.MetricType = "generic"
+			config.Spec.ExporterConfig.API.Path = tt.path
+			reader, route, err := Stream(config, bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if route.String() != tt.route {
+				t.Errorf("expected route %q, got %q", tt.route, route)
+			}
+			output, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if string(output) != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, output)
+			}
+		})
+	}
+}
+
+func TestStreamUnknown(t *testing.T) {
+	config := exporterconfig.Config{}
+	config.Spec.ExporterConfig.API.Path = "/export"
+	if _, _, err := Stream(config, bytes.NewReader([]byte{0x00, 0x01, 0x02})); err == nil {
+		t.Error("expected an error for unknown content")
+	}
+}
@@ -0,0 +1,65 @@
+package tsv
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"io"
+
+	"github.com/rs/zerolog/log"
+
+	exporterconfig "github.com/krateoplatformops/finops-prometheus-exporter/internal/config"
+)
+
+type TsvHandler struct{}
+
+func (r *TsvHandler) Resolve(config exporterconfig.Config, data []byte) ([]byte, error) {
+	reader, err := r.Stream(config, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
+// Stream converts the tab separated values into CSV while they are read
+func (r *TsvHandler) Stream(config exporterconfig.Config, data io.Reader) (io.Reader, error) {
+	log.Logger.Info().Msg("Detected tab-separated-values content-type")
+	reader := csv.NewReader(data)
+	reader.Comma = '\t'
+	reader.LazyQuotes = true
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+
+	t := &tsvReader{reader: reader}
+	t.writer = csv.NewWriter(&t.buffer)
+	return t, nil
+}
+
+// tsvReader rewrites the records of the tab separated values as CSV
+type tsvReader struct {
+	reader *csv.Reader
+	buffer bytes.Buffer
+	writer *csv.Writer
+	done   bool
+}
+
+func (t *tsvReader) Read(p []byte) (int, error) {
+	for t.buffer.Len() < len(p) && !t.done {
+		record, err := t.reader.Read()
+		if errors.Is(err, io.EOF) {
+			t.done = true
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		if err := t.writer.Write(record); err != nil {
+			return 0, err
+		}
+		t.writer.Flush()
+	}
+	if t.buffer.Len() == 0 {
+		return 0, io.EOF
+	}
+	return t.buffer.Read(p)
+}
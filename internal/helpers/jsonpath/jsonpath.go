@@ -0,0 +1,60 @@
+// Package jsonpath evaluates the JSONPath expressions of the configuration on
+// decoded JSON documents, with the syntax of kubectl.
+package jsonpath
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// Expression is a compiled JSONPath expression
+type Expression struct {
+	text string
+	path *jsonpath.JSONPath
+}
+
+// Compile parses the expression, which can be written as $.data.items,
+// .data.items, data.items or {.data.items}. Missing keys select nothing.
+func Compile(expression string) (*Expression, error) {
+	text := strings.TrimSpace(expression)
+	if text == "" {
+		return nil, fmt.Errorf("empty JSONPath expression")
+	}
+	if !strings.HasPrefix(text, "{") {
+		text = strings.TrimPrefix(text, "$")
+		if !strings.HasPrefix(text, ".") && !strings.HasPrefix(text, "[") {
+			text = "." + text
+		}
+		text = "{" + text + "}"
+	}
+
+	path := jsonpath.New(expression).AllowMissingKeys(true)
+	if err := path.Parse(text); err != nil {
+		return nil, fmt.Errorf("invalid JSONPath expression %q: %w", expression, err)
+	}
+	return &Expression{text: expression, path: path}, nil
+}
+
+func (e *Expression) String() string {
+	return e.text
+}
+
+// Find returns the values selected by the expression in the decoded JSON
+// document
+func (e *Expression) Find(data interface{}) ([]interface{}, error) {
+	results, err := e.path.FindResults(data)
+	if err != nil {
+		return nil, fmt.Errorf("could not evaluate %q: %w", e.text, err)
+	}
+	values := []interface{}{}
+	for _, result := range results {
+		for _, value := range result {
+			if value.IsValid() && value.CanInterface() {
+				values = append(values, value.Interface())
+			}
+		}
+	}
+	return values, nil
+}
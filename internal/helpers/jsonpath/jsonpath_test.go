@@ -0,0 +1,53 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestFind(t *testing.T) {
+	document := map[string]interface{}{}
+	json.Unmarshal([]byte(`{
+		"data": {
+			"items": [
+				{"id": "a", "properties": {"location": "eu"}},
+				{"id": "b", "properties": {"location": "us"}}
+			]
+		}
+	}`), &document)
+
+	tests := []struct {
+		expression string
+		expected   []interface{}
+	}{
+		{"$.data.items[*].id", []interface{}{"a", "b"}},
+		{".data.items[0].properties.location", []interface{}{"eu"}},
+		{"data.items[1].id", []interface{}{"b"}},
+		{"{.data.items[?(@.id==\"b\")].properties.location}", []interface{}{"us"}},
+		{"$.data.missing", []interface{}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			expression, err := Compile(tt.expression)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			values, err := expression.Find(document)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, values)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, expression := range []string{"", "$.data[", "{.data"} {
+		if _, err := Compile(expression); err == nil {
+			t.Errorf("expected an error for %q", expression)
+		}
+	}
+}
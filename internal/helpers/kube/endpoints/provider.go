@@ -0,0 +1,131 @@
+package endpoints
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/plumbing/endpoints"
+	"github.com/rs/zerolog/log"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+
+	finopsdatatypes "github.com/krateoplatformops/finops-data-types/api/v1"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/secrets"
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/utils"
+)
+
+// Provider resolves the Endpoint referenced by an exporter configuration and
+// caches it, so that every request shares the same credentials. The cache is
+// invalidated explicitly (e.g., after a 401 or 403) or when the Secret changes.
+type Provider struct {
+	rc      *rest.Config
+	ref     *finopsdatatypes.ObjectRef
+	resolve func(ctx context.Context) (endpoints.Endpoint, error)
+
+	mutex    sync.Mutex
+	endpoint *endpoints.Endpoint
+}
+
+// NewProvider returns a Provider for the endpoint referenced by ref, the
+// variables are replaced in the server URL of the resolved endpoint.
+func NewProvider(rc *rest.Config, ref *finopsdatatypes.ObjectRef, variables map[string]string) *Provider {
+	return &Provider{
+		rc:  rc,
+		ref: ref,
+		resolve: func(ctx context.Context) (endpoints.Endpoint, error) {
+			endpoint, err := FromSecret(ctx, rc, ref)
+			if err != nil {
+				return endpoints.Endpoint{}, err
+			}
+			endpoint.ServerURL = utils.ReplaceVariables(endpoint.ServerURL, variables)
+			return endpoint, nil
+		},
+	}
+}
+
+// NewProviderFunc returns a Provider resolving the endpoint with the given
+// function, there is no Secret to watch.
+func NewProviderFunc(resolve func(ctx context.Context) (endpoints.Endpoint, error)) *Provider {
+	return &Provider{resolve: resolve}
+}
+
+// Get returns the cached endpoint, resolving it if needed.
+func (p *Provider) Get(ctx context.Context) (*endpoints.Endpoint, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.endpoint != nil {
+		return p.endpoint, nil
+	}
+
+	endpoint, err := p.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.endpoint = &endpoint
+	return p.endpoint, nil
+}
+
+// Invalidate drops the cached endpoint, the next Get resolves it again.
+func (p *Provider) Invalidate() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.endpoint = nil
+}
+
+// Watch invalidates the cached endpoint whenever the referenced Secret
+// changes, until the context is cancelled. Without a Secret reference or
+// outside of a cluster there is nothing to watch.
+func (p *Provider) Watch(ctx context.Context) {
+	if p.ref == nil || p.rc == nil {
+		return
+	}
+	logger := log.With().Str("secret", p.ref.Namespace+"/"+p.ref.Name).Logger()
+
+	cli, err := secrets.NewSecretsRESTClient(p.rc)
+	if err != nil {
+		logger.Warn().Err(err).Msg("could not create secrets client, credentials will be refreshed only on authentication errors")
+		return
+	}
+
+	for {
+		watcher, err := secrets.WatchSecret(ctx, secrets.ClientOptions{Cli: cli, Name: p.ref.Name, Namespace: p.ref.Namespace})
+		if err != nil {
+			logger.Warn().Err(err).Msg("could not watch secret, trying again in 30s...")
+		} else {
+			p.consume(watcher)
+			watcher.Stop()
+			// The changes missed while the watch was down are picked up by the
+			// next resolution
+			p.Invalidate()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(30 * time.Second):
+		}
+	}
+}
+
+func (p *Provider) consume(watcher watch.Interface) {
+	// The first event is the current state of the Secret
+	initial := true
+	for event := range watcher.ResultChan() {
+		switch event.Type {
+		case watch.Added:
+			if initial {
+				initial = false
+				continue
+			}
+			fallthrough
+		case watch.Modified, watch.Deleted:
+			log.Info().Msgf("Secret %s/%s changed, refreshing credentials", p.ref.Namespace, p.ref.Name)
+			p.Invalidate()
+		case watch.Error:
+			return
+		}
+		initial = false
+	}
+}
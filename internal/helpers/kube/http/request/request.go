@@ -12,7 +12,6 @@ import (
 
 	xcontext "github.com/krateoplatformops/plumbing/context"
 	"github.com/krateoplatformops/plumbing/http/request"
-	"github.com/krateoplatformops/plumbing/http/util"
 	"github.com/krateoplatformops/plumbing/ptr"
 
 	localstatus "github.com/krateoplatformops/finops-prometheus-exporter/internal/helpers/kube/http/response"
@@ -21,6 +20,19 @@ import (
 const maxUnstructuredResponseTextBytes = 2048
 
 func Do(ctx context.Context, opts request.RequestOptions) *localstatus.Status {
+	var handler func(*http.Response) error
+	if opts.ResponseHandler != nil {
+		handler = func(respo *http.Response) error {
+			return opts.ResponseHandler(respo.Body)
+		}
+	}
+	return DoWithResponse(ctx, opts, handler)
+}
+
+// DoWithResponse is like Do, but the handler of successful responses receives
+// the whole response, so that the body can be processed according to its
+// headers while it is read. The ResponseHandler of the options is ignored.
+func DoWithResponse(ctx context.Context, opts request.RequestOptions, handler func(*http.Response) error) *localstatus.Status {
 	uri := strings.TrimSuffix(opts.Endpoint.ServerURL, "/")
 	if len(opts.Path) > 0 {
 		uri = fmt.Sprintf("%s/%s", uri, strings.TrimPrefix(opts.Path, "/"))
@@ -75,11 +87,9 @@ func Do(ctx context.Context, opts request.RequestOptions) *localstatus.Status {
 			fmt.Errorf("unable to create HTTP Client for endpoint: %w", err))
 	}
 
-	// Wrap the existing client in a RetryClient
-	retryCli := util.NewRetryClient(cli)
-
-	// Use RetryClient instead of the raw client  cli.Do(call)
-	respo, err := retryCli.Do(call)
+	// Retries are handled by the caller, which needs the actual status code
+	// and headers (e.g., Retry-After) of every attempt
+	respo, err := cli.Do(call)
 	if err != nil {
 		return localstatus.New(http.StatusInternalServerError, nil, err)
 	}
@@ -98,6 +108,12 @@ func Do(ctx context.Context, opts request.RequestOptions) *localstatus.Status {
 			res = localstatus.New(respo.StatusCode, &respo.Header, fmt.Errorf("%s", string(dat)))
 			return res
 		}
+		// Any JSON body can be decoded as a Status, keep the actual response code
+		res.Code = respo.StatusCode
+		res.Header = &respo.Header
+		if res.Message == "" {
+			res.Message = string(dat)
+		}
 
 		return res
 	}
@@ -107,8 +123,8 @@ func Do(ctx context.Context, opts request.RequestOptions) *localstatus.Status {
 	// 	return response.New(http.StatusNotAcceptable, fmt.Errorf("content type %q is not allowed", ct))
 	// }
 
-	if opts.ResponseHandler != nil {
-		if err := opts.ResponseHandler(respo.Body); err != nil {
+	if handler != nil {
+		if err := handler(respo); err != nil {
 			return localstatus.New(http.StatusInternalServerError, nil, err)
 		}
 		return localstatus.New(http.StatusOK, &respo.Header, nil)
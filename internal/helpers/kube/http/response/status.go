@@ -32,6 +32,7 @@ func New(code int, header *http.Header, err error) *Status {
 		Kind:       "Status",
 		APIVersion: "v1",
 		Code:       code,
+		Header:     header,
 	}
 
 	if err != nil {
@@ -83,7 +84,6 @@ func New(code int, header *http.Header, err error) *Status {
 		res.Reason = response.StatusReasonUnsupportedMediaType
 	default:
 		res.Status = response.StatusSuccess
-		res.Header = header
 	}
 
 	return res
@@ -5,9 +5,11 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/rest"
 )
 
@@ -70,3 +72,13 @@ func GetSecret(ctx context.Context, opts ClientOptions) (result *corev1.Secret,
 		Into(result)
 	return
 }
+
+// WatchSecret watches the changes of the secret identified by the options.
+func WatchSecret(ctx context.Context, opts ClientOptions) (watch.Interface, error) {
+	return opts.Cli.Get().
+		Namespace(opts.Namespace).
+		Resource("secrets").
+		Param("watch", "true").
+		Param("fieldSelector", fields.OneTermEqualSelector("metadata.name", opts.Name).String()).
+		Watch(ctx)
+}
@@ -0,0 +1,103 @@
+// Package names converts the names found in the data, e.g., the columns of
+// FOCUS exports, into the names of Prometheus metrics and labels.
+package names
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Sanitize converts a name into a valid Prometheus label or metric name: the
+// characters other than ASCII letters, digits and underscores, e.g., the dots
+// of flattened JSON keys or the spaces of CSV headers, are replaced with
+// underscores, a leading digit is prefixed with an underscore and the leading
+// underscores are reduced to one, since the names starting with __ are
+// reserved.
+func Sanitize(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	s := b.String()
+	if strings.HasPrefix(s, "__") {
+		s = "_" + strings.TrimLeft(s, "_")
+	}
+	if s == "" {
+		return "_"
+	}
+	return s
+}
+
+// Dedupe makes the names unique, in place, adding a numeric suffix to the
+// duplicated ones, e.g., cost_2 and cost_3. The names marked as preferred
+// keep their name over the others, then the first occurrence does. The
+// reserved names are never used. The result only depends on the order of the
+// names.
+func Dedupe(names []string, preferred []bool, reserved ...string) {
+	used := make(map[string]bool, len(names)+len(reserved))
+	for _, name := range reserved {
+		used[name] = true
+	}
+	kept := make([]bool, len(names))
+	for i, name := range names {
+		if i < len(preferred) && preferred[i] && !used[name] {
+			used[name] = true
+			kept[i] = true
+		}
+	}
+	for i, name := range names {
+		if kept[i] {
+			continue
+		}
+		if used[name] {
+			for n := 2; ; n++ {
+				if candidate := name + "_" + strconv.Itoa(n); !used[candidate] {
+					name = candidate
+					break
+				}
+			}
+		}
+		used[name] = true
+		names[i] = name
+	}
+}
+
+// Snake converts a name into snake case, e.g., EffectiveCost is
+// effective_cost, CPUUtilization is cpu_utilization and Percentage CPU is
+// percentage_cpu. The characters other than letters and digits separate the
+// words.
+func Snake(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	separate := false
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			separate = b.Len() > 0
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && b.Len() > 0 {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				separate = true
+			}
+		}
+		if separate {
+			b.WriteByte('_')
+			separate = false
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,56 @@
+package names
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnake(t *testing.T) {
+	tests := map[string]string{
+		"EffectiveCost":    "effective_cost",
+		"ConsumedQuantity": "consumed_quantity",
+		"CPUUtilization":   "cpu_utilization",
+		"Percentage CPU":   "percentage_cpu",
+		"x_Internal":       "x_internal",
+		"disk.read-bytes":  "disk_read_bytes",
+		"Network In Total": "network_in_total",
+		"ipv4Addresses":    "ipv4_addresses",
+		"__cost__":         "cost",
+		"already_snake":    "already_snake",
+	}
+	for name, expected := range tests {
+		if got := Snake(name); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := map[string]string{
+		"ResourceId":          "ResourceId",
+		"tags.team":           "tags_team",
+		"usage.0.unit":        "usage_0_unit",
+		"0zone":               "_0zone",
+		"x-ms-tag":            "x_ms_tag",
+		"properties/name":     "properties_name",
+		"Disk Read Bytes/sec": "Disk_Read_Bytes_sec",
+		"__name__":            "_name__",
+		"région":              "r_gion",
+		"":                    "_",
+	}
+	for name, expected := range tests {
+		if got := Sanitize(name); got != expected {
+			t.Errorf("%s: expected %s, got %s", name, expected, got)
+		}
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	names := []string{"tags_team", "tags_team", "cost", "tags_team", "cost_2", "cost", "exporter_config_name"}
+	preferred := []bool{false, true, true, false, true, false, true}
+	Dedupe(names, preferred, "exporter_config_name")
+	expected := []string{"tags_team_2", "tags_team", "cost", "tags_team_3", "cost_2", "cost_3", "exporter_config_name_2"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("expected %v, got %v", expected, names)
+	}
+}
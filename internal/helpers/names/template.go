@@ -0,0 +1,43 @@
+package names
+
+import (
+	"strings"
+	"text/template"
+)
+
+// funcs are the functions available to the templates of metric names and
+// help texts
+var funcs = template.FuncMap{
+	"snake":    Snake,
+	"sanitize": Sanitize,
+	"lower":    strings.ToLower,
+	"upper":    strings.ToUpper,
+	"trim":     strings.TrimSpace,
+	"replace": func(old, new, s string) string {
+		return strings.ReplaceAll(s, old, new)
+	},
+}
+
+// ParseTemplate parses a template of metric names or help texts. Besides the
+// functions of text/template, it provides snake, sanitize, lower, upper, trim
+// and replace (e.g., {{ .unit | replace "/" "_per_" }}). A field missing in
+// the data fails the execution of the template.
+func ParseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(funcs).Option("missingkey=error").Parse(text)
+}
+
+// Metric converts a name into a valid metric name following the conventions
+// of Prometheus for gauges: the name is sanitized, the _total suffix of
+// counters is removed and the unit, when given, is appended unless the name
+// already ends with it, e.g., disk_read with the bytes unit is
+// disk_read_bytes.
+func Metric(name string, unit string) string {
+	name = Sanitize(name)
+	if trimmed := strings.TrimSuffix(name, "_total"); trimmed != "" && trimmed != "_" {
+		name = trimmed
+	}
+	if unit != "" && !strings.HasSuffix(name, "_"+unit) {
+		name += "_" + unit
+	}
+	return name
+}
@@ -0,0 +1,47 @@
+package names
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate("name", `azure_{{ .metricName | snake }}_{{ .unit | lower | replace "/" "_per_" }}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, map[string]interface{}{"metricName": "Percentage CPU", "unit": "Bytes/Second"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.String() != "azure_percentage_cpu_bytes_per_second" {
+		t.Errorf("unexpected result: %s", b.String())
+	}
+	if err := tmpl.Execute(&b, map[string]interface{}{"metricName": "Percentage CPU"}); err == nil {
+		t.Error("expected an error for a missing field")
+	}
+	if _, err := ParseTemplate("name", "{{ .unit | unknown }}"); err == nil {
+		t.Error("expected an error for an unknown function")
+	}
+}
+
+func TestMetric(t *testing.T) {
+	tests := []struct {
+		name     string
+		unit     string
+		expected string
+	}{
+		{"billed_cost", "", "billed_cost"},
+		{"requests_total", "", "requests"},
+		{"_total", "", "_total"},
+		{"disk_read", "bytes", "disk_read_bytes"},
+		{"disk_read_bytes", "bytes", "disk_read_bytes"},
+		{"disk_read_bytes_total", "bytes", "disk_read_bytes"},
+		{"Disk Read Bytes/sec", "", "Disk_Read_Bytes_sec"},
+	}
+	for _, tt := range tests {
+		if got := Metric(tt.name, tt.unit); got != tt.expected {
+			t.Errorf("%s %s: expected %s, got %s", tt.name, tt.unit, tt.expected, got)
+		}
+	}
+}
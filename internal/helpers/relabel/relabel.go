@@ -0,0 +1,189 @@
+// Package relabel rewrites the labels of the records with rules modeled on
+// the relabel_configs of Prometheus.
+package relabel
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/common/model"
+)
+
+// Actions
+const (
+	Replace   = "replace"
+	Keep      = "keep"
+	Drop      = "drop"
+	LabelMap  = "labelmap"
+	LabelDrop = "labeldrop"
+	HashMod   = "hashmod"
+	Lowercase = "lowercase"
+)
+
+const (
+	DefaultSeparator   = ";"
+	DefaultRegex       = "(.*)"
+	DefaultReplacement = "$1"
+)
+
+// targetPattern matches the label names that may reference the capture
+// groups of the regex, e.g., tag_$1
+var targetPattern = regexp.MustCompile(`^(?:(?:[a-zA-Z_]|\$(?:\{\w+\}|\w+))+\w*)+$`)
+
+// Config is a relabeling rule, with the fields of the relabel_configs of
+// Prometheus in camel case, as in the RelabelConfig of the Prometheus
+// Operator.
+type Config struct {
+	// SourceLabels are joined by the separator into the value matched by
+	// the regex
+	SourceLabels []string `yaml:"sourceLabels"`
+	Separator    string   `yaml:"separator"`
+	// Regex is anchored at both ends, (.*) by default
+	Regex string `yaml:"regex"`
+	// TargetLabel is the label written by replace, hashmod and lowercase
+	TargetLabel string `yaml:"targetLabel"`
+	// Replacement may reference the capture groups of the regex, $1 when
+	// absent, an explicit empty replacement deletes the target label
+	Replacement *string `yaml:"replacement"`
+	// Modulus of the hash of hashmod
+	Modulus uint64 `yaml:"modulus"`
+	// Action is one of replace (default), keep, drop, labelmap, labeldrop,
+	// hashmod and lowercase
+	Action string `yaml:"action"`
+}
+
+// Rule is a compiled Config
+type Rule struct {
+	config      Config
+	regex       *regexp.Regexp
+	replacement string
+}
+
+// Compile applies the defaults to the config and validates it
+func Compile(config Config) (*Rule, error) {
+	if config.Action == "" {
+		config.Action = Replace
+	}
+	config.Action = strings.ToLower(config.Action)
+	if config.Separator == "" {
+		config.Separator = DefaultSeparator
+	}
+	if config.Regex == "" {
+		config.Regex = DefaultRegex
+	}
+	replacement := DefaultReplacement
+	if config.Replacement != nil {
+		replacement = *config.Replacement
+	}
+	regex, err := regexp.Compile("^(?:" + config.Regex + ")$")
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %s: %w", config.Regex, err)
+	}
+
+	switch config.Action {
+	case Replace:
+		if !targetPattern.MatchString(config.TargetLabel) {
+			return nil, fmt.Errorf("%s action requires a valid targetLabel: %q", config.Action, config.TargetLabel)
+		}
+	case HashMod:
+		if !model.LabelName(config.TargetLabel).IsValid() {
+			return nil, fmt.Errorf("%s action requires a valid targetLabel: %q", config.Action, config.TargetLabel)
+		}
+		if config.Modulus == 0 {
+			return nil, fmt.Errorf("%s action requires a modulus", config.Action)
+		}
+	case Lowercase:
+		if !model.LabelName(config.TargetLabel).IsValid() {
+			return nil, fmt.Errorf("%s action requires a valid targetLabel: %q", config.Action, config.TargetLabel)
+		}
+	case Keep, Drop, LabelDrop:
+	case LabelMap:
+		if !targetPattern.MatchString(replacement) {
+			return nil, fmt.Errorf("%s action requires a valid replacement: %q", config.Action, replacement)
+		}
+	default:
+		return nil, fmt.Errorf("unknown relabel action: %s", config.Action)
+	}
+	return &Rule{config: config, regex: regex, replacement: replacement}, nil
+}
+
+// Process applies the rules in order to the labels, which are modified in
+// place. It returns false when the record is dropped. The labels starting
+// with __ are removed after the last rule, so that they can hold temporary
+// values.
+func Process(labels map[string]string, rules []*Rule) bool {
+	for _, rule := range rules {
+		if !rule.apply(labels) {
+			return false
+		}
+	}
+	for name := range labels {
+		if strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			delete(labels, name)
+		}
+	}
+	return true
+}
+
+func (r *Rule) apply(labels map[string]string) bool {
+	values := make([]string, len(r.config.SourceLabels))
+	for i, name := range r.config.SourceLabels {
+		values[i] = labels[name]
+	}
+	value := strings.Join(values, r.config.Separator)
+
+	switch r.config.Action {
+	case Keep:
+		return r.regex.MatchString(value)
+	case Drop:
+		return !r.regex.MatchString(value)
+	case Replace:
+		match := r.regex.FindStringSubmatchIndex(value)
+		if match == nil {
+			return true
+		}
+		target := string(r.regex.ExpandString(nil, r.config.TargetLabel, value, match))
+		if !model.LabelName(target).IsValid() {
+			return true
+		}
+		replacement := string(r.regex.ExpandString(nil, r.replacement, value, match))
+		if replacement == "" {
+			delete(labels, target)
+		} else {
+			labels[target] = replacement
+		}
+	case Lowercase:
+		labels[r.config.TargetLabel] = strings.ToLower(value)
+	case HashMod:
+		sum := md5.Sum([]byte(value))
+		// As Prometheus, the lower 8 bytes of the hash
+		labels[r.config.TargetLabel] = fmt.Sprint(binary.BigEndian.Uint64(sum[8:]) % r.config.Modulus)
+	case LabelMap:
+		// The labels added are not matched again
+		for _, name := range sortedNames(labels) {
+			if r.regex.MatchString(name) {
+				labels[r.regex.ReplaceAllString(name, r.replacement)] = labels[name]
+			}
+		}
+	case LabelDrop:
+		for name := range labels {
+			if r.regex.MatchString(name) {
+				delete(labels, name)
+			}
+		}
+	}
+	return true
+}
+
+func sortedNames(labels map[string]string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,168 @@
+package relabel
+
+import (
+	"reflect"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name     string
+		configs  []Config
+		labels   map[string]string
+		expected map[string]string
+	}{
+		{
+			name: "replace with capture groups",
+			configs: []Config{{
+				SourceLabels: []string{"ResourceId"},
+				Regex:        "/subscriptions/([^/]+)/resourceGroups/([^/]+)/.*",
+				TargetLabel:  "resource_group",
+				Replacement:  ptr("$1/$2"),
+			}},
+			labels:   map[string]string{"ResourceId": "/subscriptions/s1/resourceGroups/rg1/providers/vm"},
+			expected: map[string]string{"ResourceId": "/subscriptions/s1/resourceGroups/rg1/providers/vm", "resource_group": "s1/rg1"},
+		},
+		{
+			name:     "replace not matching",
+			configs:  []Config{{SourceLabels: []string{"a"}, Regex: "x", TargetLabel: "b"}},
+			labels:   map[string]string{"a": "y"},
+			expected: map[string]string{"a": "y"},
+		},
+		{
+			name:     "replace with empty value deletes the target",
+			configs:  []Config{{SourceLabels: []string{"missing"}, TargetLabel: "a"}},
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{},
+		},
+		{
+			name:     "replace with explicit empty replacement deletes the target",
+			configs:  []Config{{SourceLabels: []string{"a"}, TargetLabel: "b", Replacement: ptr("")}},
+			labels:   map[string]string{"a": "x", "b": "y"},
+			expected: map[string]string{"a": "x"},
+		},
+		{
+			name:     "keep",
+			configs:  []Config{{SourceLabels: []string{"ServiceName", "Region"}, Regex: "compute;eu-.*", Action: Keep}},
+			labels:   map[string]string{"ServiceName": "compute", "Region": "eu-west"},
+			expected: map[string]string{"ServiceName": "compute", "Region": "eu-west"},
+		},
+		{
+			name:    "keep not matching",
+			configs: []Config{{SourceLabels: []string{"ServiceName"}, Regex: "compute", Action: Keep}},
+			labels:  map[string]string{"ServiceName": "storage"},
+		},
+		{
+			name:    "drop",
+			configs: []Config{{SourceLabels: []string{"ChargeCategory"}, Regex: "Tax|Credit", Action: Drop}},
+			labels:  map[string]string{"ChargeCategory": "Tax"},
+		},
+		{
+			name:     "labelmap",
+			configs:  []Config{{Regex: "tags_(.+)", Replacement: ptr("tag_$1"), Action: LabelMap}},
+			labels:   map[string]string{"tags_team": "x", "ResourceId": "vm-1"},
+			expected: map[string]string{"tags_team": "x", "tag_team": "x", "ResourceId": "vm-1"},
+		},
+		{
+			name: "labelmap and labeldrop",
+			configs: []Config{
+				{Regex: "tags_(.+)", Replacement: ptr("tag_$1"), Action: LabelMap},
+				{Regex: "tags_.+", Action: LabelDrop},
+			},
+			labels:   map[string]string{"tags_team": "x"},
+			expected: map[string]string{"tag_team": "x"},
+		},
+		{
+			name:     "hashmod",
+			configs:  []Config{{SourceLabels: []string{"ResourceId"}, TargetLabel: "shard", Modulus: 4, Action: HashMod}},
+			labels:   map[string]string{"ResourceId": "vm-1"},
+			expected: map[string]string{"ResourceId": "vm-1", "shard": "0"},
+		},
+		{
+			name:     "lowercase",
+			configs:  []Config{{SourceLabels: []string{"Region"}, TargetLabel: "region", Action: Lowercase}},
+			labels:   map[string]string{"Region": "EU-West"},
+			expected: map[string]string{"Region": "EU-West", "region": "eu-west"},
+		},
+		{
+			name: "temporary labels",
+			configs: []Config{
+				{SourceLabels: []string{"a"}, TargetLabel: "__tmp"},
+				{SourceLabels: []string{"__tmp"}, TargetLabel: "b"},
+			},
+			labels:   map[string]string{"a": "x"},
+			expected: map[string]string{"a": "x", "b": "x"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := make([]*Rule, len(tt.configs))
+			for i, config := range tt.configs {
+				rule, err := Compile(config)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				rules[i] = rule
+			}
+			kept := Process(tt.labels, rules)
+			if tt.expected == nil {
+				if kept {
+					t.Fatalf("expected the labels to be dropped, got %v", tt.labels)
+				}
+				return
+			}
+			if !kept {
+				t.Fatal("unexpected drop")
+			}
+			if !reflect.DeepEqual(tt.labels, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, tt.labels)
+			}
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, config := range []Config{
+		{Action: "uppercase", TargetLabel: "a"},
+		{Regex: "(", TargetLabel: "a"},
+		{},
+		{TargetLabel: "0a"},
+		{Action: HashMod, TargetLabel: "a"},
+		{Action: HashMod, Modulus: 2},
+		{Action: Lowercase, TargetLabel: "a-b"},
+		{Action: LabelMap, Replacement: ptr("a-$1")},
+	} {
+		if _, err := Compile(config); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
+
+func TestConfigReplacement(t *testing.T) {
+	for document, expected := range map[string]string{
+		"targetLabel: b":                    "x",
+		"targetLabel: b\nreplacement: \"\"": "",
+		"targetLabel: b\nreplacement: y$1":  "yx",
+	} {
+		var config Config
+		if err := yaml.Unmarshal([]byte(document), &config); err != nil {
+			t.Fatal(err)
+		}
+		config.SourceLabels = []string{"a"}
+		rule, err := Compile(config)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		labels := map[string]string{"a": "x"}
+		Process(labels, []*Rule{rule})
+		if labels["b"] != expected {
+			t.Errorf("%q: expected %q, got %q", document, expected, labels["b"])
+		}
+	}
+}
+
+func ptr(s string) *string {
+	return &s
+}
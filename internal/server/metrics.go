@@ -0,0 +1,69 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+	"github.com/rs/zerolog/log"
+)
+
+// Metrics serves the metrics of the gatherer. The scrapes negotiating
+// OpenMetrics get the units of the metric families (# UNIT), which promhttp
+// does not write, the others are served by promhttp. As promhttp, the
+// response is gzipped when the client accepts it and a gathering error fails
+// the scrape.
+func Metrics(gatherer prometheus.Gatherer) http.Handler {
+	handler := promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+		if format.FormatType() != expfmt.TypeOpenMetrics {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		families, err := gatherer.Gather()
+		if err != nil {
+			log.Warn().Err(err).Msg("error while gathering metrics")
+			http.Error(w, "An error has occurred while serving metrics:\n\n"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", string(format))
+		var out io.Writer = w
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			defer gz.Close()
+			out = gz
+		}
+		encoder := expfmt.NewEncoder(out, format, expfmt.WithUnit())
+		for _, family := range families {
+			if err := encoder.Encode(family); err != nil {
+				log.Warn().Err(err).Msg("error while writing metrics")
+				return
+			}
+		}
+		if closer, ok := encoder.(expfmt.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Warn().Err(err).Msg("error while writing metrics")
+			}
+		}
+	})
+}
+
+// acceptsGzip returns whether the Accept-Encoding header of the request lists
+// gzip without disabling it, e.g., gzip;q=0
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) != "gzip" {
+			continue
+		}
+		return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+	}
+	return false
+}
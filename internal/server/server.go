@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/krateoplatformops/finops-prometheus-exporter/internal/exporter"
+)
+
+// Healthz reports that the process is alive.
+func Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// Readyz reports ready when every exporter completed at least one poll and
+// its data is not older than maxIntervals polling intervals.
+func Readyz(exporters []*exporter.Exporter, maxIntervals int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		notReady := []string{}
+		for _, e := range exporters {
+			if err := e.Ready(now, maxIntervals); err != nil {
+				notReady = append(notReady, err.Error())
+			}
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(notReady) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			for _, reason := range notReady {
+				w.Write([]byte(reason + "\n"))
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok\n"))
+	})
+}
+
+// Status serves the status of every exporter as JSON.
+func Status(exporters []*exporter.Exporter) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		statuses := make([]exporter.Status, 0, len(exporters))
+		for _, e := range exporters {
+			statuses = append(statuses, e.Status())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(map[string]any{"exporters": statuses}); err != nil {
+			log.Warn().Err(err).Msg("error while writing status")
+		}
+	})
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"bufio"
 	"bytes"
-	"errors"
+	"io"
+	"mime"
 	"os"
 	"regexp"
 	"strings"
@@ -14,7 +16,10 @@ import (
 	binaryhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/binary"
 	csvhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/csv"
 	jsonhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/json"
+	ndjsonhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/ndjson"
 	octethandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/octet"
+	parquethandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/parquet"
+	tsvhandler "github.com/krateoplatformops/finops-prometheus-exporter/internal/handlers/tsv"
 
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
@@ -22,29 +27,15 @@ import (
 )
 
 /*
-* Function to remove the encoding bytes from a file.
-* @param file The file to remove the encoding from.
+* Function to skip the UTF-8 byte order mark at the beginning of a stream.
+* @param reader The stream to remove the encoding from.
  */
-func TrapBOM(file []byte) []byte {
-	return bytes.Trim(file, "\xef\xbb\xbf")
-}
-
-/*
-* Given the records from the csv file, it returns the index of the "toFind" column.
-* @param records The csv file as a 2D array of strings
-* @param toFind the column to find
-* @return the index of the "toFind" column
- */
-func GetIndexOf(records [][]string, toFind string) (int, error) {
-	log.Debug().Msgf("Looking for %s", toFind)
-	if len(records) > 0 {
-		for i, value := range records[0] {
-			if strings.EqualFold(value, toFind) {
-				return i, nil
-			}
-		}
+func SkipBOM(reader io.Reader) io.Reader {
+	buffered := bufio.NewReader(reader)
+	if bom, err := buffered.Peek(3); err == nil && bytes.Equal(bom, []byte("\xef\xbb\xbf")) {
+		buffered.Discard(3)
 	}
-	return -1, errors.New(toFind + " not found")
+	return buffered
 }
 
 func GetClientSet() (*kubernetes.Clientset, error) {
@@ -94,27 +85,25 @@ func ReplaceVariables(text string, additionalVariables map[string]string) string
 	return text
 }
 
-func CustomJoinWihtoutX(headers []string, arrayToJoin []string, sep string) string {
-	result := ""
-	for i, value := range arrayToJoin {
-		if !strings.HasPrefix(headers[i], "x_") {
-			result += value + sep
-		}
-	}
-	return result
-}
-
 func GetHandler(name string) (handlers.Handler, bool) {
 	handlers := map[string]handlers.Handler{
-		"text/csv":                 &csvhandler.CsvHandler{},
-		"application/json":         &jsonhandler.JsonHandler{},
-		"application/octet-stream": &octethandler.OctetHandler{},
-		"binary/octet-stream":      &binaryhandler.BinaryHandler{},
+		"text/csv":                       &csvhandler.CsvHandler{},
+		"text/tab-separated-values":      &tsvhandler.TsvHandler{},
+		"application/json":               &jsonhandler.JsonHandler{},
+		"application/x-ndjson":           &ndjsonhandler.NdjsonHandler{},
+		"application/ndjson":             &ndjsonhandler.NdjsonHandler{},
+		"application/jsonl":              &ndjsonhandler.NdjsonHandler{},
+		"application/vnd.apache.parquet": &parquethandler.ParquetHandler{},
+		"application/x-parquet":          &parquethandler.ParquetHandler{},
+		"application/octet-stream":       &octethandler.OctetHandler{},
+		"binary/octet-stream":            &binaryhandler.BinaryHandler{},
+		"text/plain":                     &octethandler.OctetHandler{},
 	}
-	for k, v := range handlers {
-		if strings.Contains(name, k) {
-			return v, true
-		}
+	// Parameters such as charset are ignored
+	mediaType, _, err := mime.ParseMediaType(name)
+	if err != nil {
+		mediaType = strings.TrimSpace(strings.Split(name, ";")[0])
 	}
-	return nil, false
+	handler, ok := handlers[strings.ToLower(mediaType)]
+	return handler, ok
 }